@@ -2,6 +2,8 @@ package blockstm
 
 import (
 	"fmt"
+	"runtime"
+	"slices"
 	"strings"
 	"time"
 
@@ -176,15 +178,152 @@ func (d DAG) LongestPath(stats map[int]ExecutionStat) ([]int, uint64) {
 	return path, maxPathWeight
 }
 
-func (d DAG) Report(stats map[int]ExecutionStat, out func(string)) {
-	longestPath, weight := d.LongestPath(stats)
+// serialWeight returns the sum of the execution times of all the transactions
+func (d DAG) serialWeight(stats map[int]ExecutionStat) (weight uint64) {
+	for i := 0; i < len(d.GetVertices()); i++ {
+		weight += stats[i].End - stats[i].Start
+	}
 
-	serialWeight := uint64(0)
+	return
+}
 
-	for i := 0; i < len(d.GetVertices()); i++ {
-		serialWeight += stats[i].End - stats[i].Start
+// TheoreticalSpeedup returns the speedup of an ideal parallel execution over a serial one, i.e. the sum of
+// the execution times of all the transactions divided by the execution time of the longest path.
+func (d DAG) TheoreticalSpeedup(stats map[int]ExecutionStat) float64 {
+	_, weight := d.LongestPath(stats)
+	if weight == 0 {
+		return 0
+	}
+
+	return float64(d.serialWeight(stats)) / float64(weight)
+}
+
+// realizedSpeedup returns the sum of the execution times of all the transactions divided by the time from
+// the start of the first execution to the end of the last one
+func (d DAG) realizedSpeedup(stats map[int]ExecutionStat) float64 {
+	var start, end uint64
+
+	first := true
+
+	for _, stat := range stats {
+		if first || stat.Start < start {
+			start = stat.Start
+			first = false
+		}
+
+		end = max(end, stat.End)
+	}
+
+	if end <= start {
+		return 0
+	}
+
+	return float64(d.serialWeight(stats)) / float64(end-start)
+}
+
+// criticalPathLength returns the number of transactions on the longest chain of dependencies
+func (d DAG) criticalPathLength() (length int) {
+	vertices := d.GetVertices()
+
+	ids := make([]string, 0, len(vertices))
+	for id := range vertices {
+		ids = append(ids, id)
+	}
+
+	// dependencies point to later transactions, so the parents of a transaction are visited before it
+	slices.SortFunc(ids, func(a, b string) int {
+		return vertices[a].(int) - vertices[b].(int)
+	})
+
+	depth := make(map[string]int, len(ids))
+
+	for _, id := range ids {
+		parents, _ := d.GetParents(id)
+
+		for p := range parents {
+			depth[id] = max(depth[id], depth[p])
+		}
+
+		depth[id]++
+		length = max(length, depth[id])
+	}
+
+	return
+}
+
+// RecommendedWorkers returns the number of workers worth spawning for the block, the number of
+// transactions divided by the length of its critical path, rounded up and capped at GOMAXPROCS. Further
+// workers would mostly wait for dependencies.
+func (d DAG) RecommendedWorkers() int {
+	length := d.criticalPathLength()
+	if length == 0 {
+		return 1
+	}
+
+	workers := (d.GetOrder() + length - 1) / length
+
+	return max(1, min(workers, runtime.GOMAXPROCS(0)))
+}
+
+// connectedComponents partitions the transactions into groups connected by dependencies in either
+// direction, transactions of different groups can be executed fully in parallel. The transactions of
+// a group are sorted, and the groups are ordered by their lowest transaction.
+func (d DAG) connectedComponents() [][]int {
+	vertices := d.GetVertices()
+
+	// union-find, the root of a group is its lowest transaction
+	parent := make(map[int]int, len(vertices))
+
+	find := func(tx int) int {
+		for parent[tx] != tx {
+			parent[tx] = parent[parent[tx]]
+			tx = parent[tx]
+		}
+
+		return tx
+	}
+
+	for _, v := range vertices {
+		parent[v.(int)] = v.(int)
+	}
+
+	for id, v := range vertices {
+		children, _ := d.GetChildren(id)
+
+		for _, c := range children {
+			a, b := find(v.(int)), find(c.(int))
+			if a != b {
+				parent[max(a, b)] = min(a, b)
+			}
+		}
+	}
+
+	groups := make(map[int][]int)
+
+	for tx := range parent {
+		root := find(tx)
+		groups[root] = append(groups[root], tx)
+	}
+
+	ret := make([][]int, 0, len(groups))
+
+	for _, g := range groups {
+		slices.Sort(g)
+		ret = append(ret, g)
 	}
 
+	slices.SortFunc(ret, func(a, b []int) int {
+		return a[0] - b[0]
+	})
+
+	return ret
+}
+
+func (d DAG) Report(stats map[int]ExecutionStat, out func(string)) {
+	longestPath, weight := d.LongestPath(stats)
+
+	serialWeight := d.serialWeight(stats)
+
 	makeStrs := func(ints []int) (ret []string) {
 		for _, v := range ints {
 			ret = append(ret, fmt.Sprint(v))
@@ -198,4 +337,6 @@ func (d DAG) Report(stats map[int]ExecutionStat, out func(string)) {
 
 	out(fmt.Sprintf("Longest path ideal execution time: %v of %v (serial total), %v%%", time.Duration(weight),
 		time.Duration(serialWeight), fmt.Sprintf("%.1f", float64(weight)*100.0/float64(serialWeight))))
+
+	out(fmt.Sprintf("Speedup: %.2fx (theoretical), %.2fx (realized)", d.TheoreticalSpeedup(stats), d.realizedSpeedup(stats)))
 }
@@ -0,0 +1,117 @@
+package blockstm
+
+import (
+	"runtime"
+	"testing"
+
+	"github.com/heimdalr/dag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTheoreticalSpeedup(t *testing.T) {
+	t.Parallel()
+
+	// 0 -> 2 -> 3
+	//      ^
+	// 1 ---'
+	d := DAG{dag.NewDAG()}
+	ids := make([]string, 4)
+
+	for i := range ids {
+		ids[i], _ = d.AddVertex(i)
+	}
+
+	require.NoError(t, d.AddEdge(ids[0], ids[2]))
+	require.NoError(t, d.AddEdge(ids[1], ids[2]))
+	require.NoError(t, d.AddEdge(ids[2], ids[3]))
+
+	stats := map[int]ExecutionStat{
+		0: {TxIdx: 0, Start: 100, End: 110},
+		1: {TxIdx: 1, Start: 100, End: 120},
+		2: {TxIdx: 2, Start: 120, End: 125},
+		3: {TxIdx: 3, Start: 125, End: 130},
+	}
+
+	path, weight := d.LongestPath(stats)
+	require.Equal(t, []int{1, 2, 3}, path)
+	require.Equal(t, uint64(30), weight)
+
+	// 40 units of work, of which 30 have to run one after another
+	require.InDelta(t, 40.0/30.0, d.TheoreticalSpeedup(stats), 1e-9)
+	require.InDelta(t, 40.0/30.0, d.realizedSpeedup(stats), 1e-9)
+
+	// an execution which didn't run the independent transactions in parallel
+	stats[1] = ExecutionStat{TxIdx: 1, Start: 110, End: 130}
+	stats[2] = ExecutionStat{TxIdx: 2, Start: 130, End: 135}
+	stats[3] = ExecutionStat{TxIdx: 3, Start: 135, End: 140}
+
+	require.InDelta(t, 40.0/30.0, d.TheoreticalSpeedup(stats), 1e-9)
+	require.InDelta(t, 1.0, d.realizedSpeedup(stats), 1e-9)
+
+	// the first execution may start at time 0, stats are relative to the start of the block
+	stats[0] = ExecutionStat{TxIdx: 0, Start: 0, End: 10}
+	stats[1] = ExecutionStat{TxIdx: 1, Start: 0, End: 20}
+	stats[2] = ExecutionStat{TxIdx: 2, Start: 20, End: 25}
+	stats[3] = ExecutionStat{TxIdx: 3, Start: 25, End: 30}
+
+	require.InDelta(t, 40.0/30.0, d.realizedSpeedup(stats), 1e-9)
+}
+
+func TestConnectedComponents(t *testing.T) {
+	t.Parallel()
+
+	// 0 -> 3 -> 4    1 -> 5
+	//      ^
+	// 2 ---'
+	d := DAG{dag.NewDAG()}
+	ids := make([]string, 6)
+
+	for i := range ids {
+		ids[i], _ = d.AddVertex(i)
+	}
+
+	require.NoError(t, d.AddEdge(ids[0], ids[3]))
+	require.NoError(t, d.AddEdge(ids[2], ids[3]))
+	require.NoError(t, d.AddEdge(ids[3], ids[4]))
+	require.NoError(t, d.AddEdge(ids[1], ids[5]))
+
+	require.Equal(t, [][]int{{0, 2, 3, 4}, {1, 5}}, d.connectedComponents())
+}
+
+func TestRecommendedWorkers(t *testing.T) {
+	t.Parallel()
+
+	// makeDAG returns a DAG of n transactions with the given dependencies
+	makeDAG := func(n int, edges [][2]int) DAG {
+		d := DAG{dag.NewDAG()}
+		ids := make([]string, n)
+
+		for i := range ids {
+			ids[i], _ = d.AddVertex(i)
+		}
+
+		for _, e := range edges {
+			require.NoError(t, d.AddEdge(ids[e[0]], ids[e[1]]))
+		}
+
+		return d
+	}
+
+	procs := runtime.GOMAXPROCS(0)
+
+	for _, tt := range []struct {
+		name     string
+		d        DAG
+		critical int
+		workers  int
+	}{
+		{"empty", makeDAG(0, nil), 0, 1},
+		{"serial", makeDAG(4, [][2]int{{0, 1}, {1, 2}, {2, 3}}), 4, 1},
+		{"two chains", makeDAG(8, [][2]int{{0, 2}, {2, 4}, {4, 6}, {1, 3}, {3, 5}, {5, 7}}), 4, min(2, procs)},
+		{"diamond", makeDAG(4, [][2]int{{0, 1}, {0, 2}, {1, 3}, {2, 3}}), 3, min(2, procs)},
+		{"independent", makeDAG(64, nil), 1, min(64, procs)},
+	} {
+		require.Equal(t, tt.critical, tt.d.criticalPathLength(), tt.name)
+		require.Equal(t, tt.workers, tt.d.RecommendedWorkers(), tt.name)
+	}
+}
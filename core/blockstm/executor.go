@@ -4,19 +4,24 @@ import (
 	"container/heap"
 	"context"
 	"fmt"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/log"
+	"github.com/ethereum/go-ethereum/metrics"
 )
 
+var commitLagGauge = metrics.NewRegisteredGauge("blockstm/commitlag", nil)
+
 type ExecResult struct {
 	err      error
 	ver      Version
 	txIn     TxnInput
 	txOut    TxnOutput
 	txAllOut TxnOutput
+	flagged  bool
 }
 
 type ExecTask interface {
@@ -30,6 +35,13 @@ type ExecTask interface {
 	Dependencies() []int
 }
 
+// FlaggedExecTask is implemented by tasks which can report that their last execution ran an opcode denied
+// by the opcode policy. The result of such an execution is only accepted once all the tasks before it are
+// validated, i.e. the task is executed serially.
+type FlaggedExecTask interface {
+	Flagged() bool
+}
+
 type ExecVersionView struct {
 	ver    Version
 	et     ExecTask
@@ -47,6 +59,10 @@ func (ev *ExecVersionView) Execute() (er ExecResult) {
 	er.txOut = ev.et.MVWriteList()
 	er.txAllOut = ev.et.MVFullWriteList()
 
+	if f, ok := ev.et.(FlaggedExecTask); ok {
+		er.flagged = f.Flagged()
+	}
+
 	return
 }
 
@@ -164,6 +180,7 @@ type ParallelExecutionResult struct {
 	Stats   *map[int]ExecutionStat
 	Deps    *DAG
 	AllDeps map[int]map[int]bool
+	Flagged []int // tasks which ran an opcode denied by the opcode policy, in index order
 }
 
 const numGoProcs = 1
@@ -234,6 +251,17 @@ type ParallelExecutor struct {
 	// A map that records whether a transaction result has been speculatively validated
 	preValidated map[int]bool
 
+	// Tasks which ran a flagged opcode, and those of them waiting for all the tasks before them to be
+	// validated so they can be executed serially
+	flagged     map[int]bool
+	serialTasks map[int]bool
+
+	// Run the lowest uncommitted task alone so that it is never aborted, see WithGuaranteedProgress
+	guaranteedProgress bool
+
+	// The task currently executing alone in guaranteed progress mode, -1 if none
+	exclusiveTx int
+
 	// Time records when the parallel execution starts
 	begin time.Time
 
@@ -252,7 +280,53 @@ type ExecutionStat struct {
 	Worker      int
 }
 
-func NewParallelExecutor(tasks []ExecTask, profile bool, metadata bool, numProcs int) *ParallelExecutor {
+// ExecutorOption configures a ParallelExecutor at construction
+type ExecutorOption func(*ParallelExecutor)
+
+// WithGuaranteedProgress makes the executor wait for all the tasks in flight to finish before dispatching
+// the lowest-index uncommitted task, and hold back every other task until it is done. Running alone and
+// after all the tasks before it were validated, that task can't be aborted, so the block always makes
+// progress even when speculative executions keep conflicting with each other.
+func WithGuaranteedProgress() ExecutorOption {
+	return func(pe *ParallelExecutor) {
+		pe.guaranteedProgress = true
+	}
+}
+
+// WithSchedulingTrace records the scheduling events of the execution tasks, see SchedulingTrace
+func WithSchedulingTrace() ExecutorOption {
+	return func(pe *ParallelExecutor) {
+		pe.execTasks.setTracing(true)
+	}
+}
+
+// WithDeadline fails the execution with a ParallelExecFailedError once d has passed, no new tasks are
+// dispatched after it, so the caller can execute the block serially instead
+func WithDeadline(d time.Time) ExecutorOption {
+	return func(pe *ParallelExecutor) {
+		pe.execTasks.setDeadline(d)
+	}
+}
+
+// WithMaxIncarnations forces a task into serial execution once it was executed more than max times
+// without its result being used, so a task that keeps conflicting with the ones around it stops wasting
+// speculative executions (0 = no limit)
+func WithMaxIncarnations(max int) ExecutorOption {
+	return func(pe *ParallelExecutor) {
+		pe.execTasks.setMaxIncarnations(max)
+	}
+}
+
+// WithMaxDependencyEdges fails the execution with a ParallelExecFailedError once the dependency map of
+// the tasks grows beyond max edges, so a block with dense conflicts is executed serially instead of
+// blowing up the memory (0 = no limit)
+func WithMaxDependencyEdges(max int) ExecutorOption {
+	return func(pe *ParallelExecutor) {
+		pe.execTasks.setMaxEdges(max)
+	}
+}
+
+func NewParallelExecutor(tasks []ExecTask, profile bool, metadata bool, numProcs int, opts ...ExecutorOption) *ParallelExecutor {
 	numTasks := len(tasks)
 
 	var resultQueue SafeQueue
@@ -288,10 +362,17 @@ func NewParallelExecutor(tasks []ExecTask, profile bool, metadata bool, numProcs
 		txIncarnations:      make([]int, numTasks),
 		estimateDeps:        make(map[int][]int),
 		preValidated:        make(map[int]bool),
+		flagged:             make(map[int]bool),
+		serialTasks:         make(map[int]bool),
+		exclusiveTx:         -1,
 		begin:               time.Now(),
 		profile:             profile,
 	}
 
+	for _, opt := range opts {
+		opt(pe)
+	}
+
 	return pe
 }
 
@@ -318,9 +399,9 @@ func (pe *ParallelExecutor) Prepare() error {
 				clearPendingFlag = false
 			}
 		} else {
+			// the nonce order of a sender holds even when the estimated dependencies of tx are dropped
 			if tx, ok := prevSenderTx[t.Sender()]; ok {
-				pe.execTasks.addDependencies(tx, i)
-				pe.execTasks.clearPending(i)
+				pe.execTasks.requireBefore(tx, i)
 			}
 
 			prevSenderTx[t.Sender()] = i
@@ -418,9 +499,14 @@ func (pe *ParallelExecutor) Close(wait bool) {
 func (pe *ParallelExecutor) Step(res *ExecResult) (result ParallelExecutionResult, err error) {
 	tx := res.ver.TxnIndex
 
+	if tx == pe.exclusiveTx {
+		pe.exclusiveTx = -1
+	}
+
 	if abortErr, ok := res.err.(ErrExecAbortError); ok && abortErr.OriginError != nil && pe.skipCheck[tx] {
 		// If the transaction failed when we know it should not fail, this means the transaction itself is
 		// bad (e.g. wrong nonce), and we should exit the execution immediately
+		pe.execTasks.reportError(tx, abortErr.OriginError)
 		err = fmt.Errorf("could not apply tx %d [%v]: %w", tx, pe.tasks[tx].Hash(), abortErr.OriginError)
 		pe.Close(true)
 
@@ -460,7 +546,7 @@ func (pe *ParallelExecutor) Step(res *ExecResult) (result ParallelExecutionResul
 		pe.execTasks.clearInProgress(tx)
 
 		if !addedDependencies {
-			pe.execTasks.pushPending(tx)
+			pe.execTasks.reschedule(tx, rescheduleAbort)
 		}
 
 		pe.txIncarnations[tx]++
@@ -473,12 +559,14 @@ func (pe *ParallelExecutor) Step(res *ExecResult) (result ParallelExecutionResul
 			pe.lastTxIO.recordWrite(tx, res.txOut)
 			pe.lastTxIO.recordAllWrite(tx, res.txAllOut)
 		} else {
-			if res.txAllOut.hasNewWrite(pe.lastTxIO.AllWriteSet(tx)) {
-				pe.validateTasks.pushPendingSet(pe.execTasks.getRevalidationRange(tx + 1))
-			}
-
 			prevWrite := pe.lastTxIO.AllWriteSet(tx)
 
+			if res.txAllOut.hasNewWrite(prevWrite) {
+				// the readers of the keys which are no longer written have to be revalidated too
+				writes := append(slices.Clone(res.txAllOut), prevWrite...)
+				pe.revalidate(pe.execTasks.getRevalidationRangeFor(tx+1, writes, pe.lastTxIO))
+			}
+
 			// Remove entries that were previously written but are no longer written
 
 			cmpMap := make(map[Key]bool)
@@ -497,18 +585,40 @@ func (pe *ParallelExecutor) Step(res *ExecResult) (result ParallelExecutionResul
 			pe.lastTxIO.recordAllWrite(tx, res.txAllOut)
 		}
 
-		pe.validateTasks.pushPending(tx)
-		pe.execTasks.markComplete(tx)
+		if res.flagged {
+			pe.flagged[tx] = true
+		}
+
+		// nolint: nestif
+		if res.flagged && !pe.skipCheck[tx] {
+			// the speculative result can't be trusted, the task is executed again once all the tasks before it
+			// are validated
+			for _, v := range res.txAllOut {
+				pe.mvh.MarkEstimate(v.Path, tx)
+			}
+
+			pe.execTasks.clearInProgress(tx)
+			pe.serialTasks[tx] = true
+
+			pe.txIncarnations[tx]++
+			pe.diagExecAbort[tx]++
+			pe.cntAbort++
+		} else {
+			pe.validateTasks.pushPending(tx)
+			pe.execTasks.markComplete(tx)
 
-		pe.diagExecSuccess[tx]++
-		pe.cntSuccess++
+			pe.diagExecSuccess[tx]++
+			pe.cntSuccess++
 
-		pe.execTasks.removeDependency(tx)
+			pe.execTasks.removeDependency(tx)
+		}
 	}
 
 	// do validations ...
 	maxComplete := pe.execTasks.maxAllComplete()
 
+	commitLagGauge.Update(int64(pe.execTasks.commitLag()))
+
 	toValidate := make([]int, 0, 2)
 
 	for pe.validateTasks.minPending() <= maxComplete && pe.validateTasks.minPending() >= 0 {
@@ -522,6 +632,7 @@ func (pe *ParallelExecutor) Step(res *ExecResult) (result ParallelExecutionResul
 
 		if pe.skipCheck[tx] || ValidateVersion(tx, pe.lastTxIO, pe.mvh) {
 			pe.validateTasks.markComplete(tx)
+			pe.execTasks.markValidated(tx)
 		} else {
 			pe.cntValidationFail++
 
@@ -530,11 +641,11 @@ func (pe *ParallelExecutor) Step(res *ExecResult) (result ParallelExecutionResul
 				pe.mvh.MarkEstimate(v.Path, tx)
 			}
 			// 'create validation tasks for all transactions > tx ...'
-			pe.validateTasks.pushPendingSet(pe.execTasks.getRevalidationRange(tx + 1))
+			pe.revalidate(pe.execTasks.getRevalidationRange(tx + 1))
 			pe.validateTasks.clearInProgress(tx) // clear in progress - pending will be added again once new incarnation executes
 
 			pe.execTasks.clearComplete(tx)
-			pe.execTasks.pushPending(tx)
+			pe.execTasks.reschedule(tx, rescheduleConflict)
 
 			pe.preValidated[tx] = false
 			pe.txIncarnations[tx]++
@@ -567,18 +678,61 @@ func (pe *ParallelExecutor) Step(res *ExecResult) (result ParallelExecutionResul
 			deps = BuildDAG(*pe.lastTxIO)
 		}
 
-		return ParallelExecutionResult{pe.lastTxIO, &pe.stats, &deps, allDeps}, err
+		return ParallelExecutionResult{pe.lastTxIO, &pe.stats, &deps, allDeps, pe.flaggedTasks()}, err
+	}
+
+	// Give up on the parallel execution once the deadline has passed, the remaining txs are executed serially
+	if pe.execTasks.deadlinePassed() {
+		err = ParallelExecFailedError{fmt.Sprintf("deadline passed with %d txs incomplete", len(pe.execTasks.incompleteTasks()))}
+		pe.Close(true)
+
+		return
+	}
+
+	// Give up once the dependency map grew beyond its bound, be it from the dependencies added by Prepare
+	// or by the aborts since
+	if pe.execTasks.serialFallback() {
+		err = ParallelExecFailedError{fmt.Sprintf("too many dependencies (%d), falling back to serial execution", pe.execTasks.edgeCount())}
+		pe.Close(true)
+
+		return
+	}
+
+	// Release a flagged task for its serial execution
+	if pe.serialTasks[maxValidated+1] {
+		delete(pe.serialTasks, maxValidated+1)
+		pe.execTasks.reschedule(maxValidated+1, rescheduleSerial)
+	}
+
+	// Nothing else is dispatched while a task runs alone
+	if pe.exclusiveTx != -1 {
+		return
 	}
 
 	// Send the next immediate pending transaction to be executed
 	if pe.execTasks.minPending() != -1 && pe.execTasks.minPending() == maxValidated+1 {
+		// wait for the tasks in flight to drain first, the result of the last of them triggers the dispatch
+		if pe.guaranteedProgress && pe.execTasks.inProgressCount() > 0 {
+			return
+		}
+
 		nextTx := pe.execTasks.takeNextPending()
 		if nextTx != -1 {
 			pe.cntExec++
 
-			pe.skipCheck[nextTx] = true
+			// the pending task may be held back, only the task right after the validated ones sees their final
+			// writes and can't fail validation
+			if nextTx == maxValidated+1 {
+				pe.skipCheck[nextTx] = true
+			}
 
 			pe.chTasks <- ExecVersionView{ver: Version{nextTx, pe.txIncarnations[nextTx]}, et: pe.tasks[nextTx], mvh: pe.mvh, sender: pe.tasks[nextTx].Sender()}
+
+			if pe.guaranteedProgress {
+				pe.exclusiveTx = nextTx
+
+				return
+			}
 		}
 	}
 
@@ -586,27 +740,61 @@ func (pe *ParallelExecutor) Step(res *ExecResult) (result ParallelExecutionResul
 	for pe.execTasks.minPending() != -1 {
 		nextTx := pe.execTasks.takeNextPending()
 
-		if nextTx != -1 {
-			pe.cntExec++
+		// nothing can be dispatched right now (e.g. a task forced into serial execution holds the rest back)
+		if nextTx == -1 {
+			break
+		}
+
+		pe.cntExec++
+
+		task := ExecVersionView{ver: Version{nextTx, pe.txIncarnations[nextTx]}, et: pe.tasks[nextTx], mvh: pe.mvh, sender: pe.tasks[nextTx].Sender()}
+
+		pe.specTaskQueue.Push(nextTx, task)
+		pe.chSpeculativeTasks <- struct{}{}
+	}
 
-			task := ExecVersionView{ver: Version{nextTx, pe.txIncarnations[nextTx]}, et: pe.tasks[nextTx], mvh: pe.mvh, sender: pe.tasks[nextTx].Sender()}
+	return
+}
 
-			pe.specTaskQueue.Push(nextTx, task)
-			pe.chSpeculativeTasks <- struct{}{}
+// SchedulingTrace returns the scheduling events of the execution tasks in order, if WithSchedulingTrace
+// is set
+func (pe *ParallelExecutor) SchedulingTrace() []SchedEvent {
+	return pe.execTasks.SchedulingTrace()
+}
+
+func (pe *ParallelExecutor) flaggedTasks() (ret []int) {
+	for tx := range pe.tasks {
+		if pe.flagged[tx] {
+			ret = append(ret, tx)
 		}
 	}
 
 	return
 }
 
+// revalidate queues the validation of the given tasks again, their previous validations no longer hold
+func (pe *ParallelExecutor) revalidate(set []int) {
+	pe.validateTasks.pushPendingSet(set)
+
+	for _, tx := range set {
+		pe.execTasks.clearValidated(tx)
+	}
+}
+
+// executedUnvalidated returns the tasks whose latest incarnation finished executing but hasn't passed
+// validation yet, in index order. These make up the validation work queue.
+func (pe *ParallelExecutor) executedUnvalidated() []int {
+	return pe.execTasks.needsValidation()
+}
+
 type PropertyCheck func(*ParallelExecutor) error
 
-func executeParallelWithCheck(tasks []ExecTask, profile bool, check PropertyCheck, metadata bool, numProcs int, interruptCtx context.Context) (result ParallelExecutionResult, err error) {
+func executeParallelWithCheck(tasks []ExecTask, profile bool, check PropertyCheck, metadata bool, numProcs int, interruptCtx context.Context, opts ...ExecutorOption) (result ParallelExecutionResult, err error) {
 	if len(tasks) == 0 {
-		return ParallelExecutionResult{MakeTxnInputOutput(len(tasks)), nil, nil, nil}, nil
+		return ParallelExecutionResult{MakeTxnInputOutput(len(tasks)), nil, nil, nil, nil}, nil
 	}
 
-	pe := NewParallelExecutor(tasks, profile, metadata, numProcs)
+	pe := NewParallelExecutor(tasks, profile, metadata, numProcs, opts...)
 	err = pe.Prepare()
 
 	if err != nil {
@@ -640,6 +828,6 @@ func executeParallelWithCheck(tasks []ExecTask, profile bool, check PropertyChec
 	return
 }
 
-func ExecuteParallel(tasks []ExecTask, profile bool, metadata bool, numProcs int, interruptCtx context.Context) (result ParallelExecutionResult, err error) {
-	return executeParallelWithCheck(tasks, profile, nil, metadata, numProcs, interruptCtx)
+func ExecuteParallel(tasks []ExecTask, profile bool, metadata bool, numProcs int, interruptCtx context.Context, opts ...ExecutorOption) (result ParallelExecutionResult, err error) {
+	return executeParallelWithCheck(tasks, profile, nil, metadata, numProcs, interruptCtx, opts...)
 }
@@ -2,10 +2,13 @@ package blockstm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
 	"os"
+	"slices"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -387,7 +390,7 @@ func composeValidations(checks []PropertyCheck) PropertyCheck {
 func checkNoStatusOverlap(pe *ParallelExecutor) error {
 	seen := make(map[int]string)
 
-	for _, tx := range pe.execTasks.complete {
+	for _, tx := range pe.execTasks.complete.tasks() {
 		seen[tx] = "complete"
 	}
 
@@ -413,7 +416,7 @@ func checkNoStatusOverlap(pe *ParallelExecutor) error {
 func checkNoDroppedTx(pe *ParallelExecutor) error {
 	for i := 0; i < len(pe.tasks); i++ {
 		if !pe.execTasks.checkComplete(i) && !pe.execTasks.checkInProgress(i) && !pe.execTasks.checkPending(i) {
-			if !pe.execTasks.isBlocked(i) {
+			if !pe.execTasks.isBlocked(i) && !pe.serialTasks[i] {
 				return fmt.Errorf("tx %v is not in any status and is not blocked by any other tx", i)
 			}
 		}
@@ -928,6 +931,255 @@ func TestDexScenarioWithMetadata(t *testing.T) {
 	testExecutorCombWithMetadata(t, totalTxs, numReads, numWrites, numNonIO, taskRunner)
 }
 
+// flaggedTestExecTask is a task whose executions always run an opcode denied by the opcode policy
+type flaggedTestExecTask struct {
+	*testExecTask
+}
+
+func (t flaggedTestExecTask) Flagged() bool {
+	return true
+}
+
+func TestFlaggedTasksExecuteSerially(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i % 10))) }
+	tasks, _ := taskFactory(50, sender, 20, 20, 50, randomPathGenerator, readTime, writeTime, nonIOTime)
+
+	flagged := []int{0, 5, 20, 49}
+	for _, tx := range flagged {
+		tasks[tx] = flaggedTestExecTask{tasks[tx].(*testExecTask)}
+	}
+
+	// a flagged task may only complete from an execution started after all the tasks before it were validated
+	checkSerial := func(pe *ParallelExecutor) error {
+		for _, tx := range flagged {
+			if pe.execTasks.checkComplete(tx) && !pe.skipCheck[tx] {
+				return fmt.Errorf("flagged tx %d completed speculatively", tx)
+			}
+		}
+
+		return nil
+	}
+
+	checks := composeValidations([]PropertyCheck{checkNoStatusOverlap, checkNoDroppedTx, checkSerial})
+
+	result, err := executeParallelWithCheck(tasks, false, checks, false, numProcs, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, flagged, result.Flagged)
+}
+
+func TestValidatedFollowsValidation(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i))) }
+	tasks, _ := taskFactory(200, sender, 20, 20, 50, dexPathGenerator, readTime, writeTime, nonIOTime)
+
+	validations := 0
+
+	// a task is validated exactly while its latest incarnation passed validation
+	checkValidated := func(pe *ParallelExecutor) error {
+		for tx := range pe.tasks {
+			if have, want := pe.execTasks.checkValidated(tx), pe.validateTasks.checkComplete(tx); have != want {
+				return fmt.Errorf("tx %d: validated %v, passed validation %v", tx, have, want)
+			}
+		}
+
+		validations = max(validations, len(pe.execTasks.validated))
+
+		return nil
+	}
+
+	checks := composeValidations([]PropertyCheck{checkNoStatusOverlap, checkNoDroppedTx, checkValidated})
+
+	_, err := executeParallelWithCheck(tasks, false, checks, false, numProcs, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, len(tasks), validations, "not all txs were validated")
+}
+
+func TestSerialFallbackOrderDuringExecution(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i))) }
+	tasks, _ := taskFactory(100, sender, 20, 20, 50, randomPathGenerator, readTime, writeTime, nonIOTime)
+
+	resumed := false
+
+	// a fallback keeps the validated prefix and runs every other task, in index order
+	checkOrder := func(pe *ParallelExecutor) error {
+		order := pe.execTasks.serialFallbackOrder()
+		kept := len(tasks) - len(order)
+
+		for tx := 0; tx < kept; tx++ {
+			if !pe.validateTasks.checkComplete(tx) {
+				return fmt.Errorf("fallback order %v skips tx %d which didn't pass validation", order, tx)
+			}
+		}
+
+		for i, tx := range order {
+			if tx != kept+i {
+				return fmt.Errorf("fallback order %v isn't the tasks after %d in index order", order, kept-1)
+			}
+		}
+
+		if kept > 0 && len(order) > 0 {
+			resumed = true
+		}
+
+		return nil
+	}
+
+	checks := composeValidations([]PropertyCheck{checkNoStatusOverlap, checkNoDroppedTx, checkOrder})
+
+	_, err := executeParallelWithCheck(tasks, false, checks, false, numProcs, nil)
+	assert.NoError(t, err)
+	assert.True(t, resumed, "a fallback never kept any validated tx")
+}
+
+func TestMaxDependencyEdges(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i))) }
+
+	// every task reads and writes the same keys, so speculative executions keep aborting on each other
+	tasks, _ := taskFactory(100, sender, 10, 10, 10, dexPathGenerator, readTime, writeTime, nonIOTime)
+
+	_, err := executeParallelWithCheck(tasks, false, checkNoStatusOverlap, false, numProcs, nil, WithMaxDependencyEdges(2))
+	assert.ErrorAs(t, err, &ParallelExecFailedError{})
+
+	_, err = executeParallelWithCheck(tasks, false, checkNoStatusOverlap, false, numProcs, nil, WithMaxDependencyEdges(len(tasks)*len(tasks)))
+	assert.NoError(t, err)
+}
+
+func TestMaxDependencyEdgesFromMetadata(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	// distinct senders and no conflicts, the only edges are the ones given by the metadata
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i))) }
+	tasks, _ := taskFactory(10, sender, 1, 1, 0, randomPathGenerator, readTime, writeTime, nonIOTime)
+
+	for i := 1; i < len(tasks); i++ {
+		tasks[i].(*testExecTask).dependencies = []int{0}
+	}
+
+	_, err := executeParallelWithCheck(tasks, false, checkNoStatusOverlap, true, numProcs, nil, WithMaxDependencyEdges(2))
+	assert.ErrorAs(t, err, &ParallelExecFailedError{})
+
+	_, err = executeParallelWithCheck(tasks, false, checkNoStatusOverlap, true, numProcs, nil, WithMaxDependencyEdges(len(tasks)))
+	assert.NoError(t, err)
+}
+
+func TestSkipCheckOnlyAfterValidated(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i))) }
+	tasks, _ := taskFactory(100, sender, 10, 10, 10, dexPathGenerator, readTime, writeTime, nonIOTime)
+
+	for _, tx := range []int{3, 40, 41, 77} {
+		tasks[tx] = flaggedTestExecTask{tasks[tx].(*testExecTask)}
+	}
+
+	// a task skips its validation only if all the tasks before it were validated when it was dispatched
+	checkSkipCheck := func(pe *ParallelExecutor) error {
+		for _, tx := range pe.execTasks.inProgress {
+			if pe.skipCheck[tx] && pe.validateTasks.maxAllComplete() < tx-1 {
+				return fmt.Errorf("tx %d skips its validation, but only the txs up to %d are validated", tx, pe.validateTasks.maxAllComplete())
+			}
+		}
+
+		return nil
+	}
+
+	checks := composeValidations([]PropertyCheck{checkNoStatusOverlap, checkNoDroppedTx, checkSkipCheck})
+
+	// tasks forced into serial execution hold back the pending tasks after them
+	_, err := executeParallelWithCheck(tasks, false, checks, false, numProcs, nil, WithMaxIncarnations(2))
+	assert.NoError(t, err)
+}
+
+func TestSenderOrder(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	// runs of 5 txs share a sender
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i / 5))) }
+	tasks, _ := taskFactory(100, sender, 10, 10, 10, dexPathGenerator, readTime, writeTime, nonIOTime)
+
+	completed := make(map[int]bool)
+
+	// a tx is never started before the previous tx of its sender completed
+	checkSenderOrder := func(pe *ParallelExecutor) error {
+		for tx := range pe.tasks {
+			if pe.execTasks.checkComplete(tx) {
+				completed[tx] = true
+			}
+		}
+
+		for _, tx := range pe.execTasks.inProgress {
+			if tx%5 != 0 && !completed[tx-1] {
+				return fmt.Errorf("tx %d started before tx %d of the same sender completed", tx, tx-1)
+			}
+		}
+
+		return nil
+	}
+
+	checks := composeValidations([]PropertyCheck{checkNoStatusOverlap, checkNoDroppedTx, checkSenderOrder})
+
+	_, err := executeParallelWithCheck(tasks, false, checks, false, numProcs, nil)
+	assert.NoError(t, err)
+}
+
+func TestExecutedUnvalidated(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i))) }
+
+	// the first task is slow, so the tasks after it finish executing long before they can be validated
+	slowFirst := func(txIdx int, opIdx int) time.Duration {
+		if txIdx == 0 {
+			return time.Millisecond
+		}
+
+		return time.Microsecond
+	}
+
+	tasks, _ := taskFactory(50, sender, 5, 5, 10, randomPathGenerator, readTime, writeTime, slowFirst)
+
+	maxUnvalidated := 0
+
+	checkUnvalidated := func(pe *ParallelExecutor) error {
+		unvalidated := pe.executedUnvalidated()
+
+		for _, tx := range unvalidated {
+			if !pe.execTasks.checkComplete(tx) || pe.execTasks.checkValidated(tx) {
+				return fmt.Errorf("tx %d is not executed and unvalidated", tx)
+			}
+		}
+
+		if len(unvalidated) != pe.execTasks.countComplete()-len(pe.execTasks.validated) {
+			return fmt.Errorf("executed and unvalidated txs %v don't match the complete txs", unvalidated)
+		}
+
+		maxUnvalidated = max(maxUnvalidated, len(unvalidated))
+
+		return nil
+	}
+
+	checks := composeValidations([]PropertyCheck{checkNoStatusOverlap, checkNoDroppedTx, checkUnvalidated})
+
+	_, err := executeParallelWithCheck(tasks, false, checks, false, numProcs, nil)
+	assert.NoError(t, err)
+	assert.Greater(t, maxUnvalidated, 0, "no tx was ever executed without being validated")
+}
+
 func TestBreakFromCircularDependency(t *testing.T) {
 	t.Parallel()
 	rand.New(rand.NewSource(0))
@@ -986,3 +1238,194 @@ func TestBreakFromPartialCircularDependency(t *testing.T) {
 		t.Error("Expected cancel error")
 	}
 }
+
+// contendedTestExecTask is a task whose execution aborts whenever another task executes at the same time.
+// It blames the first task, which doesn't block it once that one is complete, so an optimistic scheduler
+// keeps re-executing the tasks against each other and never gets past them.
+type contendedTestExecTask struct {
+	*testExecTask
+	running, started *atomic.Int32
+}
+
+func (t contendedTestExecTask) Execute(mvh *MVHashMap, incarnation int) error {
+	start := t.started.Add(1)
+	n := t.running.Add(1)
+
+	defer t.running.Add(-1)
+
+	err := t.testExecTask.Execute(mvh, incarnation)
+
+	time.Sleep(time.Millisecond)
+
+	if n > 1 || t.started.Load() != start {
+		return ErrExecAbortError{Dependency: 0}
+	}
+
+	return err
+}
+
+func TestGuaranteedProgress(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i))) }
+	tasks, _ := taskFactory(30, sender, 5, 5, 10, randomPathGenerator, readTime, writeTime, nonIOTime)
+
+	running, started := new(atomic.Int32), new(atomic.Int32)
+	for i := range tasks {
+		tasks[i] = contendedTestExecTask{tasks[i].(*testExecTask), running, started}
+	}
+
+	// the lowest uncommitted task never runs next to another one
+	checkExclusive := func(pe *ParallelExecutor) error {
+		if pe.exclusiveTx != -1 && pe.execTasks.inProgressCount() != 1 {
+			return fmt.Errorf("tx %d runs alone but %d txs are in progress", pe.exclusiveTx, pe.execTasks.inProgressCount())
+		}
+
+		return nil
+	}
+
+	checks := composeValidations([]PropertyCheck{checkNoStatusOverlap, checkNoDroppedTx, checkExclusive})
+
+	result, err := executeParallelWithCheck(tasks, false, checks, false, numProcs, nil, WithGuaranteedProgress())
+	assert.NoError(t, err)
+	assert.NotNil(t, result.TxIO)
+}
+
+var errBadTx = errors.New("bad tx")
+
+// badTestExecTask is a task that always fails with an error of its own, as a tx with a wrong nonce does
+type badTestExecTask struct {
+	*testExecTask
+}
+
+func (t badTestExecTask) Execute(mvh *MVHashMap, incarnation int) error {
+	if err := t.testExecTask.Execute(mvh, incarnation); err != nil {
+		return err
+	}
+
+	return ErrExecAbortError{Dependency: -1, OriginError: errBadTx}
+}
+
+func TestBadTxReportsError(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i))) }
+	tasks, _ := taskFactory(50, sender, 5, 5, 10, randomPathGenerator, readTime, writeTime, nonIOTime)
+	tasks[20] = badTestExecTask{tasks[20].(*testExecTask)}
+
+	var pe *ParallelExecutor
+
+	capture := func(p *ParallelExecutor) { pe = p }
+
+	_, err := executeParallelWithCheck(tasks, false, checkNoStatusOverlap, false, numProcs, nil, capture)
+	assert.ErrorIs(t, err, errBadTx)
+	assert.ErrorContains(t, err, "could not apply tx 20")
+
+	// the status manager stops dispatching once the bad tx is reported
+	assert.Equal(t, SchedFailed, pe.execTasks.schedulingState())
+	assert.ErrorIs(t, pe.execTasks.firstError(), errBadTx)
+	assert.Equal(t, -1, pe.execTasks.takeNextPending())
+}
+
+func TestMaxIncarnations(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i))) }
+	tasks, _ := taskFactory(30, sender, 5, 5, 10, randomPathGenerator, readTime, writeTime, nonIOTime)
+
+	running, started := new(atomic.Int32), new(atomic.Int32)
+	for i := range tasks {
+		tasks[i] = contendedTestExecTask{tasks[i].(*testExecTask), running, started}
+	}
+
+	// a task forced into serial execution never runs next to another one
+	checkForcedAlone := func(pe *ParallelExecutor) error {
+		for _, tx := range pe.execTasks.forcedSerial() {
+			if pe.execTasks.checkInProgress(tx) && pe.execTasks.inProgressCount() != 1 {
+				return fmt.Errorf("tx %d is forced into serial execution but %d txs are in progress", tx, pe.execTasks.inProgressCount())
+			}
+		}
+
+		return nil
+	}
+
+	checks := composeValidations([]PropertyCheck{checkNoStatusOverlap, checkNoDroppedTx, checkForcedAlone})
+
+	var pe *ParallelExecutor
+
+	capture := func(p *ParallelExecutor) { pe = p }
+
+	result, err := executeParallelWithCheck(tasks, false, checks, false, numProcs, nil, WithMaxIncarnations(1), capture)
+	assert.NoError(t, err)
+	assert.NotNil(t, result.TxIO)
+	assert.NotEmpty(t, pe.execTasks.forcedSerial())
+}
+
+// abortOnceTestExecTask is a task whose first incarnation aborts
+type abortOnceTestExecTask struct {
+	*testExecTask
+}
+
+func (t abortOnceTestExecTask) Execute(mvh *MVHashMap, incarnation int) error {
+	if err := t.testExecTask.Execute(mvh, incarnation); err != nil || incarnation > 0 {
+		return err
+	}
+
+	return ErrExecAbortError{Dependency: -1}
+}
+
+func TestIncarnationCountedOnce(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	// distinct senders and no accesses besides the nonce, so no task conflicts with another
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i))) }
+	tasks, _ := taskFactory(10, sender, 1, 1, 0, randomPathGenerator, readTime, writeTime, nonIOTime)
+	tasks[5] = abortOnceTestExecTask{tasks[5].(*testExecTask)}
+
+	var pe *ParallelExecutor
+
+	capture := func(p *ParallelExecutor) { pe = p }
+
+	_, err := executeParallelWithCheck(tasks, false, checkNoStatusOverlap, false, numProcs, nil, capture)
+	assert.NoError(t, err)
+
+	for tx := range tasks {
+		want := 0
+		if tx == 5 {
+			want = 1
+		}
+
+		assert.Equal(t, want, pe.execTasks.incarnations[tx], "tx %d", tx)
+		assert.Equal(t, pe.txIncarnations[tx], pe.execTasks.incarnations[tx], "tx %d", tx)
+	}
+}
+
+func TestDeadlineFailsExecution(t *testing.T) {
+	t.Parallel()
+	rand.New(rand.NewSource(0))
+
+	sender := func(i int) common.Address { return common.BigToAddress(big.NewInt(int64(i))) }
+	tasks, _ := taskFactory(1000, sender, 10, 10, 10, randomPathGenerator, readTime, writeTime, nonIOTime)
+
+	var pe *ParallelExecutor
+
+	capture := func(p *ParallelExecutor) { pe = p }
+
+	_, err := executeParallelWithCheck(tasks, false, checkNoStatusOverlap, false, numProcs, nil, WithDeadline(time.Now().Add(5*time.Millisecond)), capture)
+
+	var failed ParallelExecFailedError
+	assert.ErrorAs(t, err, &failed)
+
+	incomplete := pe.execTasks.incompleteTasks()
+	assert.NotEmpty(t, incomplete)
+	assert.EqualError(t, err, fmt.Sprintf("deadline passed with %d txs incomplete", len(incomplete)))
+
+	// the reported txs are exactly the ones which didn't complete
+	for tx := range tasks {
+		assert.Equal(t, !pe.execTasks.checkComplete(tx), slices.Contains(incomplete, tx), "tx %d", tx)
+	}
+}
@@ -0,0 +1,33 @@
+package blockstm
+
+import "fmt"
+
+// TaskResult is the outcome of the final incarnation of a task, as handed over to the commit layer
+type TaskResult struct {
+	TxIdx       int
+	Incarnation int
+	Reads       []ReadDescriptor
+	Writes      []WriteDescriptor
+}
+
+// MergeResults orders the results of a block's tasks, which finish in any order, by task index. The
+// results have to be complete, i.e. hold exactly one result for each task from 0 to len(results)-1,
+// otherwise an error is returned as the block can't be committed.
+func MergeResults(results map[int]TaskResult) ([]TaskResult, error) {
+	merged := make([]TaskResult, len(results))
+
+	for tx := range merged {
+		res, ok := results[tx]
+		if !ok {
+			return nil, fmt.Errorf("missing result of tx %d", tx)
+		}
+
+		if res.TxIdx != tx {
+			return nil, fmt.Errorf("result of tx %d recorded as tx %d", res.TxIdx, tx)
+		}
+
+		merged[tx] = res
+	}
+
+	return merged, nil
+}
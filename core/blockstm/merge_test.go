@@ -0,0 +1,45 @@
+package blockstm
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMergeResults(t *testing.T) {
+	t.Parallel()
+
+	results := make(map[int]TaskResult)
+
+	// results arrive out of order, in various incarnations
+	for _, tx := range []int{3, 0, 4, 1, 2} {
+		results[tx] = TaskResult{TxIdx: tx, Incarnation: tx % 2}
+	}
+
+	merged, err := MergeResults(results)
+	require.NoError(t, err)
+	require.Len(t, merged, 5)
+
+	for i, res := range merged {
+		require.Equal(t, i, res.TxIdx)
+		require.Equal(t, i%2, res.Incarnation)
+	}
+
+	merged, err = MergeResults(map[int]TaskResult{})
+	require.NoError(t, err)
+	require.Empty(t, merged)
+
+	// a gap in the results
+	delete(results, 2)
+	results[5] = TaskResult{TxIdx: 5}
+
+	_, err = MergeResults(results)
+	require.EqualError(t, err, "missing result of tx 2")
+
+	// a result stored under the wrong index
+	results[2] = TaskResult{TxIdx: 5}
+	delete(results, 5)
+
+	_, err = MergeResults(results)
+	require.EqualError(t, err, "result of tx 5 recorded as tx 2")
+}
@@ -2,15 +2,108 @@ package blockstm
 
 import (
 	"fmt"
+	"math/bits"
+	"slices"
 	"sort"
+	"time"
+)
+
+// SchedState tells why takeNextPending has no task to hand out
+type SchedState int
+
+const (
+	SchedMoreWork       SchedState = iota // a pending task can be taken
+	SchedWaitingOnDeps                    // nothing can be taken, remaining tasks are in progress, blocked or held back
+	SchedAllComplete                      // all tasks have completed
+	SchedDeadlinePassed                   // tasks are pending but the deadline has passed
+	SchedFailed                           // an error was reported, see firstError
+)
+
+func (s SchedState) String() string {
+	switch s {
+	case SchedMoreWork:
+		return "MoreWork"
+	case SchedWaitingOnDeps:
+		return "WaitingOnDeps"
+	case SchedAllComplete:
+		return "AllComplete"
+	case SchedDeadlinePassed:
+		return "DeadlinePassed"
+	case SchedFailed:
+		return "Failed"
+	default:
+		return fmt.Sprintf("SchedState(%d)", int(s))
+	}
+}
+
+// SchedEventKind is the kind of a scheduling event recorded in the trace of the status manager
+type SchedEventKind int
+
+const (
+	SchedTakePending      SchedEventKind = iota // a pending task is dispatched
+	SchedMarkComplete                           // a task in progress completes
+	SchedAddDependency                          // a task is blocked by another one
+	SchedRemoveDependency                       // the tasks blocked by a task are released
+	SchedPushPending                            // a task is pushed back to pending
+)
+
+func (k SchedEventKind) String() string {
+	switch k {
+	case SchedTakePending:
+		return "TakePending"
+	case SchedMarkComplete:
+		return "MarkComplete"
+	case SchedAddDependency:
+		return "AddDependency"
+	case SchedRemoveDependency:
+		return "RemoveDependency"
+	case SchedPushPending:
+		return "PushPending"
+	default:
+		return fmt.Sprintf("SchedEventKind(%d)", int(k))
+	}
+}
+
+// SchedEvent is a scheduling event of a task, Blocker is the blocking task of a SchedAddDependency and
+// -1 for the other kinds
+type SchedEvent struct {
+	Kind    SchedEventKind
+	Tx      int
+	Blocker int
+}
+
+func (e SchedEvent) String() string {
+	if e.Kind == SchedAddDependency {
+		return fmt.Sprintf("%v(%d, blocker %d)", e.Kind, e.Tx, e.Blocker)
+	}
+
+	return fmt.Sprintf("%v(%d)", e.Kind, e.Tx)
+}
+
+// Reasons for pushing a task back to pending, see reschedule
+const (
+	rescheduleAbort     = "abort"     // the execution aborted, e.g. on reading an estimate
+	rescheduleConflict  = "conflict"  // the result failed validation
+	rescheduleUnblocked = "unblocked" // the tasks it was waiting for are done
+	rescheduleSerial    = "serial"    // a flagged task is released for its serial execution
 )
 
 func makeStatusManager(numTasks int) (t taskStatusManager) {
+	t.numTasks = numTasks
+
 	t.pending = make([]int, numTasks)
 	for i := 0; i < numTasks; i++ {
 		t.pending[i] = i
 	}
 
+	// preallocated, so they don't grow while the tasks are dispatched and completed
+	t.inProgress = make([]int, 0, numTasks)
+	t.complete = newCompleteSet(numTasks)
+	t.completion = make([]int, 0, numTasks)
+	t.dispatchedAt = make(map[int]time.Time, numTasks)
+	t.inProgressTime = make(map[int]time.Duration, numTasks)
+	t.validated = make(map[int]bool, numTasks)
+	t.ordering = make(map[int]map[int]bool)
 	t.dependency = make(map[int]map[int]bool, numTasks)
 	t.blocker = make(map[int]map[int]bool, numTasks)
 
@@ -22,11 +115,115 @@ func makeStatusManager(numTasks int) (t taskStatusManager) {
 }
 
 type taskStatusManager struct {
+	numTasks   int
 	pending    []int
 	inProgress []int
-	complete   []int
+	complete   completeSet
+	completion []int        // tasks in the order they were marked complete, including re-executions
+	validated  map[int]bool // complete tasks whose last incarnation passed validation
 	dependency map[int]map[int]bool
 	blocker    map[int]map[int]bool
+
+	// hard ordering edges from requireBefore, these are dependencies which are only removed once the
+	// blocker has completed
+	ordering map[int]map[int]bool
+
+	// no new tasks are dispatched once the deadline has passed, zero means no deadline
+	deadline time.Time
+
+	// first error reported by reportError, no new tasks are dispatched after it
+	err error
+
+	// number of edges in the dependency map, exceeding maxEdges (if non-zero) switches the block to
+	// serial execution
+	edges       int
+	maxEdges    int
+	edgesCapped bool
+
+	// why each task was last pushed back to pending, see reschedule
+	rescheduleReasons map[int]string
+
+	// scheduling events in order, only recorded if tracing is enabled, see setTracing
+	tracing bool
+	trace   []SchedEvent
+
+	// number of executions of each task which were aborted or failed validation
+	incarnations map[int]int
+
+	// tasks whose incarnations exceeded maxIncarnations (if non-zero), which are executed alone, see
+	// forcedSerial
+	maxIncarnations int
+	forced          map[int]bool
+
+	// when each task was last dispatched, and the time it spent in progress over all its executions
+	dispatchedAt   map[int]time.Time
+	inProgressTime map[int]time.Duration
+	now            func() time.Time // clock of the timings, time.Now if nil
+}
+
+// completeSet tracks the complete tasks in a bitmap, along with the watermark below which all tasks are
+// complete, so tasks completing out of order are added in constant time.
+type completeSet struct {
+	bits      []uint64
+	count     int
+	watermark int // tasks [0, watermark) are all complete
+}
+
+func newCompleteSet(numTasks int) completeSet {
+	return completeSet{bits: make([]uint64, (numTasks+63)/64)}
+}
+
+func (s *completeSet) has(tx int) bool {
+	return tx >= 0 && tx/64 < len(s.bits) && s.bits[tx/64]&(1<<(tx%64)) != 0
+}
+
+func (s *completeSet) add(tx int) {
+	if s.has(tx) {
+		return
+	}
+
+	for tx/64 >= len(s.bits) {
+		s.bits = append(s.bits, 0)
+	}
+
+	s.bits[tx/64] |= 1 << (tx % 64)
+	s.count++
+
+	for s.has(s.watermark) {
+		s.watermark++
+	}
+}
+
+func (s *completeSet) remove(tx int) {
+	if !s.has(tx) {
+		return
+	}
+
+	s.bits[tx/64] &^= 1 << (tx % 64)
+	s.count--
+
+	if tx < s.watermark {
+		s.watermark = tx
+	}
+}
+
+// len returns the number of complete tasks
+func (s *completeSet) len() int {
+	return s.count
+}
+
+// tasks returns the complete tasks in index order
+func (s *completeSet) tasks() []int {
+	ret := make([]int, 0, s.count)
+
+	for i, word := range s.bits {
+		for word != 0 {
+			ret = append(ret, i*64+bits.TrailingZeros64(word))
+			word &= word - 1
+		}
+	}
+
+	return ret
 }
 
 func insertInList(l []int, v int) []int {
@@ -47,39 +244,175 @@ func insertInList(l []int, v int) []int {
 }
 
 func (m *taskStatusManager) takeNextPending() int {
-	if len(m.pending) == 0 {
+	if m.deadlinePassed() || m.err != nil {
+		return -1
+	}
+
+	i := m.nextSchedulable()
+	if i == -1 {
 		return -1
 	}
 
-	x := m.pending[0]
-	m.pending = m.pending[1:]
+	return m.dispatch(i)
+}
+
+// dispatch moves the pending task at position i to in progress
+func (m *taskStatusManager) dispatch(i int) int {
+	x := m.pending[i]
+	if i == 0 {
+		m.pending = m.pending[1:]
+	} else {
+		m.pending = append(m.pending[:i], m.pending[i+1:]...)
+	}
+
 	m.inProgress = insertInList(m.inProgress, x)
+	m.dispatchedAt[x] = m.clock()
+	m.record(SchedTakePending, x, -1)
 
 	return x
 }
 
-func hasNoGap(l []int) bool {
-	return l[0]+len(l) == l[len(l)-1]+1
+// nextSchedulable returns the position of the next pending task to dispatch, or -1. Tasks held back by a
+// task forced into serial execution are skipped.
+func (m *taskStatusManager) nextSchedulable() int {
+	for i, tx := range m.pending {
+		if !m.serialHeld(tx) {
+			return i
+		}
+	}
+
+	return -1
+}
+
+// setDeadline stops the dispatch of new tasks once d has passed
+func (m *taskStatusManager) setDeadline(d time.Time) {
+	m.deadline = d
 }
 
-func (m taskStatusManager) maxAllComplete() int {
-	if len(m.complete) == 0 || m.complete[0] != 0 {
-		return -1
-	} else if m.complete[len(m.complete)-1] == len(m.complete)-1 {
-		return m.complete[len(m.complete)-1]
-	} else {
-		for i := len(m.complete) - 2; i >= 0; i-- {
-			if hasNoGap(m.complete[:i+1]) {
-				return m.complete[i]
-			}
+func (m *taskStatusManager) deadlinePassed() bool {
+	return !m.deadline.IsZero() && m.clock().After(m.deadline)
+}
+
+// reportError records that tx failed irrecoverably, no new tasks are dispatched afterwards. Only the
+// first error is kept, see firstError.
+func (m *taskStatusManager) reportError(tx int, err error) {
+	if m.err == nil {
+		m.err = fmt.Errorf("task %d: %w", tx, err)
+	}
+}
+
+// firstError returns the first error reported by reportError, nil if there's none
+func (m *taskStatusManager) firstError() error {
+	return m.err
+}
+
+// incompleteTasks returns all tasks which haven't completed yet, in index order, so they can be
+// executed serially once the deadline has passed
+func (m *taskStatusManager) incompleteTasks() (ret []int) {
+	for tx := 0; tx < m.numTasks; tx++ {
+		if !m.checkComplete(tx) {
+			ret = append(ret, tx)
 		}
 	}
 
-	return -1
+	return
+}
+
+// serialFallbackOrder returns the tasks a serial executor has to run, in order, to resume a block whose
+// parallel execution failed. Only the validated prefix can be kept, later tasks which completed may have
+// read speculative state and are executed again.
+func (m *taskStatusManager) serialFallbackOrder() (ret []int) {
+	for tx := m.maxAllValidated() + 1; tx < m.numTasks; tx++ {
+		ret = append(ret, tx)
+	}
+
+	return
+}
+
+// schedulingState disambiguates a -1 returned from takeNextPending
+func (m *taskStatusManager) schedulingState() SchedState {
+	switch {
+	case m.err != nil:
+		return SchedFailed
+	case m.complete.len() == m.numTasks:
+		return SchedAllComplete
+	case len(m.pending) == 0:
+		return SchedWaitingOnDeps
+	case m.deadlinePassed():
+		return SchedDeadlinePassed
+	case m.nextSchedulable() == -1:
+		return SchedWaitingOnDeps
+	default:
+		return SchedMoreWork
+	}
+}
+
+// commitLag returns the number of complete tasks which can't be committed yet, because a lower task
+// hasn't completed
+func (m *taskStatusManager) commitLag() int {
+	return m.countComplete() - (m.maxAllComplete() + 1)
+}
+
+// progressPercent returns the share of the tasks which are complete along with all the tasks before them,
+// in percent. It only drops when a task in that prefix is executed again. An empty block is complete.
+func (m *taskStatusManager) progressPercent() float64 {
+	if m.numTasks == 0 {
+		return 100
+	}
+
+	return float64(m.maxAllComplete()+1) / float64(m.numTasks) * 100
+}
+
+// commitBlockers returns the incomplete tasks from the commit watermark up to the next complete task,
+// i.e. the gap holding back the tasks complete after it. Without any such task, all the remaining tasks
+// are returned.
+func (m *taskStatusManager) commitBlockers() (ret []int) {
+	for tx := m.complete.watermark; tx < m.numTasks && !m.complete.has(tx); tx++ {
+		ret = append(ret, tx)
+	}
+
+	return
+}
+
+func (m *taskStatusManager) maxAllComplete() int {
+	return m.complete.watermark - 1
 }
 
 func (m *taskStatusManager) pushPending(tx int) {
 	m.pending = insertInList(m.pending, tx)
+	m.record(SchedPushPending, tx, -1)
+}
+
+// setTracing enables or disables recording the scheduling events, see SchedulingTrace
+func (m *taskStatusManager) setTracing(on bool) {
+	m.tracing = on
+}
+
+func (m *taskStatusManager) record(kind SchedEventKind, tx int, blocker int) {
+	if m.tracing {
+		m.trace = append(m.trace, SchedEvent{Kind: kind, Tx: tx, Blocker: blocker})
+	}
+}
+
+// SchedulingTrace returns the scheduling events recorded while tracing was enabled, in order, so the
+// scheduling of a block can be replayed
+func (m *taskStatusManager) SchedulingTrace() []SchedEvent {
+	return m.trace
+}
+
+// reschedule pushes tx back to pending and records why, for debugging
+func (m *taskStatusManager) reschedule(tx int, reason string) {
+	if m.rescheduleReasons == nil {
+		m.rescheduleReasons = make(map[int]string)
+	}
+
+	m.rescheduleReasons[tx] = reason
+	m.pushPending(tx)
+}
+
+// lastRescheduleReason returns why tx was last pushed back to pending, empty if it never was
+func (m *taskStatusManager) lastRescheduleReason(tx int) string {
+	return m.rescheduleReasons[tx]
 }
 
 func removeFromList(l []int, v int, expect bool) []int {
@@ -104,7 +437,75 @@ func removeFromList(l []int, v int, expect bool) []int {
 
 func (m *taskStatusManager) markComplete(tx int) {
 	m.inProgress = removeFromList(m.inProgress, tx, true)
-	m.complete = insertInList(m.complete, tx)
+	m.stopTiming(tx)
+	m.complete.add(tx)
+	m.completion = append(m.completion, tx)
+	m.record(SchedMarkComplete, tx, -1)
+
+	// a new incarnation has to be validated again
+	delete(m.validated, tx)
+}
+
+// markValidated records that the last execution of a complete task passed validation
+func (m *taskStatusManager) markValidated(tx int) {
+	if !m.checkComplete(tx) {
+		panic(fmt.Errorf("should not happen - validating task %d which is not complete", tx))
+	}
+
+	m.validated[tx] = true
+}
+
+// clearValidated records that a task has to be validated again, e.g. because a task before it changed
+// the keys it read
+func (m *taskStatusManager) clearValidated(tx int) {
+	delete(m.validated, tx)
+}
+
+func (m *taskStatusManager) checkValidated(tx int) bool {
+	return m.validated[tx]
+}
+
+// needsValidation returns the complete tasks which haven't been validated yet, in index order
+func (m *taskStatusManager) needsValidation() (ret []int) {
+	for _, tx := range m.complete.tasks() {
+		if !m.validated[tx] {
+			ret = append(ret, tx)
+		}
+	}
+
+	return
+}
+
+// maxAllValidated returns the highest task such that it and all tasks before it are validated, these
+// tasks can be committed. Returns -1 if task 0 isn't validated.
+func (m *taskStatusManager) maxAllValidated() int {
+	tx := 0
+	for tx < m.complete.watermark && m.validated[tx] {
+		tx++
+	}
+
+	return tx - 1
+}
+
+// completedTasks returns the complete tasks in index order and in the order their latest incarnation
+// completed
+func (m *taskStatusManager) completedTasks() (byIndex []int, byCompletion []int) {
+	byIndex = m.complete.tasks()
+
+	seen := make(map[int]bool, len(byIndex))
+
+	for i := len(m.completion) - 1; i >= 0; i-- {
+		tx := m.completion[i]
+		if !seen[tx] && m.checkComplete(tx) {
+			byCompletion = append(byCompletion, tx)
+		}
+
+		seen[tx] = true
+	}
+
+	slices.Reverse(byCompletion)
+
+	return
 }
 
 func (m *taskStatusManager) minPending() int {
@@ -116,7 +517,21 @@ func (m *taskStatusManager) minPending() int {
 }
 
 func (m *taskStatusManager) countComplete() int {
-	return len(m.complete)
+	return m.complete.len()
+}
+
+// CompletedCount returns the number of complete tasks, whether or not the tasks before them are complete,
+// e.g. to report progress. See maxAllComplete for the contiguous watermark.
+func (m *taskStatusManager) CompletedCount() int {
+	return m.countComplete()
+}
+
+func (m *taskStatusManager) pendingCount() int {
+	return len(m.pending)
+}
+
+func (m *taskStatusManager) inProgressCount() int {
+	return len(m.inProgress)
 }
 
 func (m *taskStatusManager) addDependencies(blocker int, dependent int) bool {
@@ -127,9 +542,14 @@ func (m *taskStatusManager) addDependencies(blocker int, dependent int) bool {
 	curblockers := m.blocker[dependent]
 
 	if m.checkComplete(blocker) {
-		// Blocker has already completed
+		// Blocker has already completed, an edge left from an earlier estimate doesn't count anymore
 		delete(curblockers, blocker)
 
+		if m.dependency[blocker][dependent] {
+			delete(m.dependency[blocker], dependent)
+			m.edges--
+		}
+
 		return len(curblockers) > 0
 	}
 
@@ -137,34 +557,104 @@ func (m *taskStatusManager) addDependencies(blocker int, dependent int) bool {
 		m.dependency[blocker] = make(map[int]bool)
 	}
 
-	m.dependency[blocker][dependent] = true
+	if !m.dependency[blocker][dependent] {
+		m.dependency[blocker][dependent] = true
+		m.edges++
+		m.record(SchedAddDependency, dependent, blocker)
+
+		if m.maxEdges > 0 && m.edges > m.maxEdges {
+			m.edgesCapped = true
+		}
+	}
+
 	curblockers[blocker] = true
 
 	return true
 }
 
+func (m *taskStatusManager) edgeCount() int {
+	return m.edges
+}
+
+// setMaxEdges bounds the memory used by the dependency map, see serialFallback
+func (m *taskStatusManager) setMaxEdges(max int) {
+	m.maxEdges = max
+}
+
+// serialFallback returns true once the dependency map has ever grown beyond the configured number of
+// edges, the block should then be executed serially instead
+func (m *taskStatusManager) serialFallback() bool {
+	return m.edgesCapped
+}
+
+// hasDependents returns true if any task is blocked on tx, i.e. completing tx may unblock other tasks
+func (m *taskStatusManager) hasDependents(tx int) bool {
+	return len(m.dependency[tx]) > 0
+}
+
 func (m *taskStatusManager) isBlocked(tx int) bool {
 	return len(m.blocker[tx]) > 0
 }
 
+// isSchedulable returns true if tx is pending and not waiting for any other task
+func (m *taskStatusManager) isSchedulable(tx int) bool {
+	return m.checkPending(tx) && !m.isBlocked(tx)
+}
+
+// requireBefore makes b wait for a to complete regardless of any data conflicts, e.g. to keep the nonce
+// order of a sender. Constraints have to be registered before any task is dispatched.
+func (m *taskStatusManager) requireBefore(a int, b int) {
+	if a < 0 || a >= b {
+		panic(fmt.Errorf("should not happen - invalid ordering constraint %d before %d", a, b))
+	}
+
+	if _, ok := m.ordering[a]; !ok {
+		m.ordering[a] = make(map[int]bool)
+	}
+
+	m.ordering[a][b] = true
+
+	if m.addDependencies(a, b) {
+		m.clearPending(b)
+	}
+}
+
 func (m *taskStatusManager) removeDependency(tx int) {
-	if deps, ok := m.dependency[tx]; ok && len(deps) > 0 {
-		for k := range deps {
-			delete(m.blocker[k], tx)
-
-			if len(m.blocker[k]) == 0 {
-				if !m.checkComplete(k) && !m.checkPending(k) && !m.checkInProgress(k) {
-					m.pushPending(k)
-				}
+	deps, ok := m.dependency[tx]
+	if !ok {
+		return
+	}
+
+	m.record(SchedRemoveDependency, tx, -1)
+
+	// ordering constraints outlive aborted dependency estimates, they are only released once tx completes
+	keepOrdering := !m.checkComplete(tx)
+
+	for k := range deps {
+		if keepOrdering && m.ordering[tx][k] {
+			continue
+		}
+
+		delete(deps, k)
+		delete(m.blocker[k], tx)
+		m.edges--
+
+		if len(m.blocker[k]) == 0 {
+			if !m.checkComplete(k) && !m.checkPending(k) && !m.checkInProgress(k) {
+				m.reschedule(k, rescheduleUnblocked)
 			}
 		}
+	}
 
+	if len(deps) == 0 {
 		delete(m.dependency, tx)
 	}
 }
 
 func (m *taskStatusManager) clearInProgress(tx int) {
 	m.inProgress = removeFromList(m.inProgress, tx, true)
+	m.stopTiming(tx)
+	m.nextIncarnation(tx)
 }
 
 func (m *taskStatusManager) checkInProgress(tx int) bool {
@@ -186,12 +676,7 @@ func (m *taskStatusManager) checkPending(tx int) bool {
 }
 
 func (m *taskStatusManager) checkComplete(tx int) bool {
-	x := sort.SearchInts(m.complete, tx)
-	if x < len(m.complete) && m.complete[x] == tx {
-		return true
-	}
-
-	return false
+	return m.complete.has(tx)
 }
 
 // getRevalidationRange: this range will be all tasks from tx (inclusive) that are not currently in progress up to the
@@ -208,6 +693,31 @@ func (m *taskStatusManager) getRevalidationRange(txFrom int) (ret []int) {
 	return
 }
 
+// getRevalidationRangeFor is getRevalidationRange for a task which wrote writes, it returns an empty range
+// without any write or if none of the tasks in the range read a written key, as they can't conflict.
+func (m *taskStatusManager) getRevalidationRangeFor(txFrom int, writes []WriteDescriptor, io *TxnInputOutput) []int {
+	if len(writes) == 0 {
+		return nil
+	}
+
+	written := make(map[Key]struct{}, len(writes))
+	for _, w := range writes {
+		written[w.Path] = struct{}{}
+	}
+
+	ret := m.getRevalidationRange(txFrom)
+
+	for _, tx := range ret {
+		for _, rd := range io.ReadSet(tx) {
+			if _, ok := written[rd.Path]; ok {
+				return ret
+			}
+		}
+	}
+
+	return nil
+}
+
 func (m *taskStatusManager) pushPendingSet(set []int) {
 	for _, v := range set {
 		if m.checkComplete(v) {
@@ -219,7 +729,101 @@ func (m *taskStatusManager) pushPendingSet(set []int) {
 }
 
 func (m *taskStatusManager) clearComplete(tx int) {
-	m.complete = removeFromList(m.complete, tx, false)
+	if m.complete.has(tx) {
+		m.nextIncarnation(tx)
+	}
+
+	m.complete.remove(tx)
+	delete(m.validated, tx)
+}
+
+func (m *taskStatusManager) clock() time.Time {
+	if m.now != nil {
+		return m.now()
+	}
+
+	return time.Now()
+}
+
+// stopTiming adds the time since tx was dispatched to its time in progress
+func (m *taskStatusManager) stopTiming(tx int) {
+	m.inProgressTime[tx] += m.clock().Sub(m.dispatchedAt[tx])
+}
+
+// taskDuration returns how long tx spent in progress, summed up over all its executions including aborted
+// ones. An execution still in progress isn't included.
+func (m *taskStatusManager) taskDuration(tx int) time.Duration {
+	return m.inProgressTime[tx]
+}
+
+// nextIncarnation records that the current execution of tx won't be used
+func (m *taskStatusManager) nextIncarnation(tx int) {
+	if m.incarnations == nil {
+		m.incarnations = make(map[int]int)
+	}
+
+	m.incarnations[tx]++
+
+	if m.maxIncarnations > 0 && m.incarnations[tx] > m.maxIncarnations && !m.forced[tx] {
+		if m.forced == nil {
+			m.forced = make(map[int]bool)
+		}
+
+		m.forced[tx] = true
+	}
+}
+
+// setMaxIncarnations bounds the re-executions of a task, a task exceeding them is forced into serial
+// execution, see forcedSerial. Zero means no limit.
+func (m *taskStatusManager) setMaxIncarnations(max int) {
+	m.maxIncarnations = max
+}
+
+// forcedSerial returns the tasks which exceeded the incarnation limit, in index order. Such a task is only
+// dispatched once all the tasks before it are complete and nothing else is in progress, and nothing else
+// is dispatched while it runs, so it doesn't conflict again.
+func (m *taskStatusManager) forcedSerial() (ret []int) {
+	for tx := range m.forced {
+		ret = append(ret, tx)
+	}
+
+	slices.Sort(ret)
+
+	return
+}
+
+// serialHeld returns true if tx can't be dispatched because of a task forced into serial execution: nothing
+// runs alongside it, and while it's pending, tasks after it aren't started so the tasks in progress drain.
+func (m *taskStatusManager) serialHeld(tx int) bool {
+	for f := range m.forced {
+		if m.checkInProgress(f) {
+			return true
+		}
+
+		if !m.checkPending(f) {
+			continue
+		}
+
+		if tx > f || (tx == f && (len(m.inProgress) > 0 || m.maxAllComplete()+1 < f)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// abortedTasks returns the tasks which aren't complete after any of their executions was aborted or failed
+// validation, in index order, e.g. for a pass re-executing just those
+func (m *taskStatusManager) abortedTasks() (ret []int) {
+	for tx, incarnation := range m.incarnations {
+		if incarnation > 0 && !m.checkComplete(tx) {
+			ret = append(ret, tx)
+		}
+	}
+
+	slices.Sort(ret)
+
+	return
 }
 
 func (m *taskStatusManager) clearPending(tx int) {
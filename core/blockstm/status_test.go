@@ -1,9 +1,16 @@
 package blockstm
 
 import (
+	"errors"
+	"math/big"
+	"math/rand"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum/go-ethereum/common"
 )
 
 func TestStatusBasics(t *testing.T) {
@@ -77,6 +84,802 @@ func TestMaxComplete(t *testing.T) {
 	s2.markComplete(4)
 	require.Equal(t, -1, s2.maxAllComplete())
 
-	s2.complete = insertInList(s2.complete, 4)
+	s2.complete.add(4)
 	require.Equal(t, 2, s2.countComplete())
 }
+
+func TestDeadline(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(6)
+
+	now := time.Unix(0, 0)
+	s.now = func() time.Time { return now }
+	s.setDeadline(now.Add(time.Second))
+
+	require.Equal(t, 0, s.takeNextPending())
+	require.Equal(t, 1, s.takeNextPending())
+	require.Equal(t, 2, s.takeNextPending())
+
+	s.markComplete(0)
+	s.markComplete(2)
+
+	now = now.Add(time.Second)
+	require.Equal(t, 3, s.takeNextPending(), "the deadline itself hasn't passed yet")
+
+	now = now.Add(time.Nanosecond)
+	require.Equal(t, -1, s.takeNextPending())
+	require.Equal(t, SchedDeadlinePassed, s.schedulingState())
+
+	// tasks still in progress may complete after the deadline
+	s.markComplete(1)
+	s.markComplete(3)
+
+	require.Equal(t, []int{4, 5}, s.incompleteTasks())
+}
+
+func TestSchedulingState(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(3)
+	require.Equal(t, SchedMoreWork, s.schedulingState())
+
+	// 2 is blocked on 0 so it isn't pending
+	s.addDependencies(0, 2)
+	s.clearPending(2)
+
+	require.Equal(t, 0, s.takeNextPending())
+	require.Equal(t, 1, s.takeNextPending())
+	require.Equal(t, -1, s.takeNextPending())
+	require.Equal(t, SchedWaitingOnDeps, s.schedulingState())
+
+	s.markComplete(0)
+	s.removeDependency(0)
+	require.Equal(t, SchedMoreWork, s.schedulingState())
+
+	s.setDeadline(time.Now().Add(-time.Second))
+	require.Equal(t, -1, s.takeNextPending())
+	require.Equal(t, SchedDeadlinePassed, s.schedulingState())
+
+	s.setDeadline(time.Time{})
+	require.Equal(t, 2, s.takeNextPending())
+	s.markComplete(1)
+	s.markComplete(2)
+	require.Equal(t, -1, s.takeNextPending())
+	require.Equal(t, SchedAllComplete, s.schedulingState())
+}
+
+func TestValidationLifecycle(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(4)
+
+	for {
+		if s.takeNextPending() == -1 {
+			break
+		}
+	}
+
+	// execute
+	s.markComplete(2)
+	s.markComplete(0)
+	s.markComplete(1)
+	require.Equal(t, []int{0, 1, 2}, s.needsValidation())
+	require.Equal(t, -1, s.maxAllValidated())
+	require.Panics(t, func() { s.markValidated(3) })
+
+	// validate, out of order
+	s.markValidated(1)
+	s.markValidated(2)
+	require.Equal(t, []int{0}, s.needsValidation())
+	require.Equal(t, -1, s.maxAllValidated())
+
+	s.markValidated(0)
+	require.Empty(t, s.needsValidation())
+	require.Equal(t, 2, s.maxAllValidated(), "0-2 can be committed")
+
+	// 1 fails a later validation and is re-executed
+	s.clearComplete(1)
+	s.pushPending(1)
+	require.False(t, s.checkValidated(1))
+	require.Equal(t, 0, s.maxAllValidated())
+
+	require.Equal(t, 1, s.takeNextPending())
+	s.markComplete(1)
+	s.markComplete(3)
+	require.Equal(t, []int{1, 3}, s.needsValidation())
+
+	s.markValidated(1)
+	s.markValidated(3)
+	require.Equal(t, 3, s.maxAllValidated(), "all tasks can be committed")
+}
+
+func TestMaxEdges(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(6)
+	s.setMaxEdges(3)
+
+	require.True(t, s.addDependencies(0, 2))
+	require.True(t, s.addDependencies(0, 3))
+	require.True(t, s.addDependencies(0, 3), "adding an edge twice doesn't count")
+	require.True(t, s.addDependencies(1, 3))
+	require.Equal(t, 3, s.edgeCount())
+	require.False(t, s.serialFallback())
+
+	require.True(t, s.addDependencies(1, 4))
+	require.Equal(t, 4, s.edgeCount())
+	require.True(t, s.serialFallback())
+
+	// the fallback is sticky even once the edges are removed again
+	s.takeNextPending()
+	s.markComplete(0)
+	s.removeDependency(0)
+	require.Equal(t, 2, s.edgeCount())
+	require.True(t, s.serialFallback())
+}
+
+func TestEdgeToCompleteBlocker(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(3)
+
+	require.True(t, s.addDependencies(0, 2))
+	require.Equal(t, 1, s.edgeCount())
+
+	// 0 completes without its dependents being released yet, adding the edge again drops it
+	s.takeNextPending()
+	s.markComplete(0)
+	require.False(t, s.addDependencies(0, 2))
+	require.Equal(t, 0, s.edgeCount())
+	require.False(t, s.hasDependents(0))
+}
+
+func TestRequireBefore(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(4)
+	s.requireBefore(1, 3)
+	require.Panics(t, func() { s.requireBefore(2, 2) })
+
+	require.Equal(t, 0, s.takeNextPending())
+	require.Equal(t, 1, s.takeNextPending())
+	require.Equal(t, 2, s.takeNextPending())
+	require.Equal(t, -1, s.takeNextPending(), "3 must wait for 1")
+
+	// 3 also gets an estimated dependency on 2, which is later dropped when 1 aborts, the ordering
+	// constraint has to survive that
+	s.addDependencies(2, 3)
+	s.removeDependency(1)
+	s.removeDependency(2)
+	require.True(t, s.isBlocked(3))
+	require.Equal(t, -1, s.takeNextPending())
+
+	s.markComplete(0)
+	s.markComplete(2)
+	s.markComplete(1)
+	s.removeDependency(1)
+	require.False(t, s.isBlocked(3))
+	require.Equal(t, 3, s.takeNextPending())
+	require.Equal(t, 0, s.edgeCount())
+}
+
+func TestCommitLag(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(6)
+
+	for {
+		if s.takeNextPending() == -1 {
+			break
+		}
+	}
+
+	require.Equal(t, 0, s.commitLag())
+
+	s.markComplete(1)
+	s.markComplete(3)
+	s.markComplete(4)
+	require.Equal(t, 3, s.commitLag(), "nothing can be committed before 0 completes")
+
+	s.markComplete(0)
+	require.Equal(t, 2, s.commitLag(), "3 and 4 wait for 2")
+
+	s.markComplete(2)
+	require.Equal(t, 0, s.commitLag())
+}
+
+func TestCommitBlockers(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(8)
+
+	for {
+		if s.takeNextPending() == -1 {
+			break
+		}
+	}
+
+	require.Equal(t, []int{0, 1, 2, 3, 4, 5, 6, 7}, s.commitBlockers())
+
+	s.markComplete(0)
+	s.markComplete(1)
+	s.markComplete(5)
+	s.markComplete(7)
+	require.Equal(t, []int{2, 3, 4}, s.commitBlockers(), "5 and 7 wait for 2, 3 and 4")
+
+	s.markComplete(3)
+	require.Equal(t, []int{2}, s.commitBlockers())
+
+	s.markComplete(2)
+	require.Equal(t, []int{4}, s.commitBlockers())
+
+	s.markComplete(4)
+	require.Equal(t, []int{6}, s.commitBlockers())
+
+	s.markComplete(6)
+	require.Empty(t, s.commitBlockers())
+}
+
+func TestLastRescheduleReason(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(4)
+
+	for {
+		if s.takeNextPending() == -1 {
+			break
+		}
+	}
+
+	require.Empty(t, s.lastRescheduleReason(1), "tx 1 was never pushed back")
+
+	s.clearInProgress(1)
+	s.reschedule(1, rescheduleAbort)
+	require.Equal(t, rescheduleAbort, s.lastRescheduleReason(1))
+
+	s.markComplete(0)
+	s.markComplete(2)
+	s.clearComplete(2)
+	s.reschedule(2, rescheduleConflict)
+	require.Equal(t, rescheduleConflict, s.lastRescheduleReason(2))
+
+	// tx 3 aborts waiting for tx 1, it's pushed back once tx 1 completes
+	s.clearInProgress(3)
+	require.True(t, s.addDependencies(1, 3))
+	require.Empty(t, s.lastRescheduleReason(3))
+
+	require.Equal(t, 1, s.takeNextPending())
+	s.markComplete(1)
+	s.removeDependency(1)
+	require.True(t, s.checkPending(3))
+	require.Equal(t, rescheduleUnblocked, s.lastRescheduleReason(3))
+
+	// the latest reason is kept
+	require.Equal(t, 2, s.takeNextPending())
+	s.clearInProgress(2)
+	s.reschedule(2, rescheduleAbort)
+	require.Equal(t, rescheduleAbort, s.lastRescheduleReason(2))
+}
+
+func TestSchedulingTrace(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(3)
+
+	// nothing is recorded unless tracing is enabled
+	require.Equal(t, 0, s.takeNextPending())
+	require.Empty(t, s.SchedulingTrace())
+
+	s.setTracing(true)
+
+	require.Equal(t, 1, s.takeNextPending())
+	require.Equal(t, 2, s.takeNextPending())
+
+	// 2 aborts on a read of 1 and waits for it
+	s.clearInProgress(2)
+	require.True(t, s.addDependencies(1, 2))
+
+	s.markComplete(0)
+	s.markComplete(1)
+	s.removeDependency(1)
+
+	require.Equal(t, 2, s.takeNextPending())
+	s.markComplete(2)
+
+	require.Equal(t, []SchedEvent{
+		{SchedTakePending, 1, -1},
+		{SchedTakePending, 2, -1},
+		{SchedAddDependency, 2, 1},
+		{SchedMarkComplete, 0, -1},
+		{SchedMarkComplete, 1, -1},
+		{SchedRemoveDependency, 1, -1},
+		{SchedPushPending, 2, -1},
+		{SchedTakePending, 2, -1},
+		{SchedMarkComplete, 2, -1},
+	}, s.SchedulingTrace())
+
+	require.Equal(t, "AddDependency(2, blocker 1)", s.SchedulingTrace()[2].String())
+	require.Equal(t, "PushPending(2)", s.SchedulingTrace()[6].String())
+}
+
+func TestIsSchedulable(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(4)
+
+	// 3 waits for 1 from the start
+	s.addDependencies(1, 3)
+	s.clearPending(3)
+
+	require.True(t, s.isSchedulable(0))
+	require.True(t, s.isSchedulable(2))
+	require.False(t, s.isSchedulable(3), "3 is blocked by 1")
+
+	// a pending task with a remaining blocker can't be scheduled either
+	s.pushPending(3)
+	require.False(t, s.isSchedulable(3))
+
+	require.Equal(t, 0, s.takeNextPending())
+	require.False(t, s.isSchedulable(0), "0 is in progress")
+
+	require.Equal(t, 1, s.takeNextPending())
+	s.markComplete(1)
+	s.removeDependency(1)
+	require.True(t, s.isSchedulable(3))
+
+	require.False(t, s.isSchedulable(1), "1 is complete")
+}
+
+func TestHasDependents(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(5)
+
+	// 3 and 4 wait for 1, 4 waits for 2 as well
+	require.True(t, s.addDependencies(1, 3))
+	require.True(t, s.addDependencies(1, 4))
+	require.True(t, s.addDependencies(2, 4))
+
+	require.False(t, s.hasDependents(0))
+	require.True(t, s.hasDependents(1))
+	require.True(t, s.hasDependents(2))
+	require.False(t, s.hasDependents(3), "3 is a leaf")
+	require.False(t, s.hasDependents(4), "4 is a leaf")
+
+	// completing 2 releases its only dependent
+	for tx := 0; tx <= 2; tx++ {
+		require.Equal(t, tx, s.takeNextPending())
+	}
+
+	s.markComplete(2)
+	s.removeDependency(2)
+	require.False(t, s.hasDependents(2))
+	require.True(t, s.hasDependents(1))
+}
+
+func TestCompletedCount(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(5)
+
+	for {
+		if s.takeNextPending() == -1 {
+			break
+		}
+	}
+
+	require.Equal(t, 0, s.CompletedCount())
+
+	s.markComplete(4)
+	s.markComplete(2)
+	require.Equal(t, 2, s.CompletedCount())
+	require.Equal(t, -1, s.maxAllComplete(), "nothing is complete from the start")
+
+	s.markComplete(0)
+	require.Equal(t, 3, s.CompletedCount())
+	require.Equal(t, 0, s.maxAllComplete())
+
+	// a task pushed back for re-execution no longer counts
+	s.clearComplete(2)
+	s.pushPending(2)
+	require.Equal(t, 2, s.CompletedCount())
+}
+
+func TestAbortedTasks(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(6)
+
+	for {
+		if s.takeNextPending() == -1 {
+			break
+		}
+	}
+
+	require.Empty(t, s.abortedTasks())
+
+	// 4 and 1 abort, 3 fails validation
+	s.clearInProgress(4)
+	s.pushPending(4)
+	s.clearInProgress(1)
+	s.pushPending(1)
+
+	s.markComplete(0)
+	s.markComplete(2)
+	s.markComplete(3)
+	s.clearComplete(3)
+	s.pushPending(3)
+
+	require.Equal(t, []int{1, 3, 4}, s.abortedTasks())
+
+	// the tasks which are executing again still count until they complete
+	require.Equal(t, 1, s.takeNextPending())
+	require.Equal(t, []int{1, 3, 4}, s.abortedTasks())
+
+	s.markComplete(1)
+	require.Equal(t, []int{3, 4}, s.abortedTasks())
+
+	// clearing a task which isn't complete doesn't abort it
+	s.clearComplete(5)
+	require.Equal(t, []int{3, 4}, s.abortedTasks())
+}
+
+func TestCompletedTasks(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(5)
+
+	for {
+		if s.takeNextPending() == -1 {
+			break
+		}
+	}
+
+	s.markComplete(3)
+	s.markComplete(1)
+	s.markComplete(4)
+	s.markComplete(0)
+
+	byIndex, byCompletion := s.completedTasks()
+	require.Equal(t, []int{0, 1, 3, 4}, byIndex)
+	require.Equal(t, []int{3, 1, 4, 0}, byCompletion)
+
+	// 1 fails validation and is executed again, 4 is still waiting for its re-execution
+	s.clearComplete(1)
+	s.clearComplete(4)
+	s.pushPendingSet([]int{1, 4})
+	require.Equal(t, 1, s.takeNextPending())
+	s.markComplete(1)
+	s.markComplete(2)
+
+	byIndex, byCompletion = s.completedTasks()
+	require.Equal(t, []int{0, 1, 2, 3}, byIndex)
+	require.Equal(t, []int{3, 0, 1, 2}, byCompletion)
+}
+
+func TestTaskCounts(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(5)
+	require.Equal(t, 5, s.pendingCount())
+	require.Equal(t, 0, s.inProgressCount())
+
+	s.takeNextPending()
+	s.takeNextPending()
+	require.Equal(t, 3, s.pendingCount())
+	require.Equal(t, 2, s.inProgressCount())
+
+	s.markComplete(0)
+	s.clearInProgress(1)
+	s.pushPending(1)
+	require.Equal(t, 4, s.pendingCount())
+	require.Equal(t, 0, s.inProgressCount())
+
+	s.pushPending(1)
+	require.Equal(t, 4, s.pendingCount(), "pushing a pending task again doesn't count")
+}
+
+func TestSerialFallbackOrder(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(6)
+	require.Equal(t, []int{0, 1, 2, 3, 4, 5}, s.serialFallbackOrder())
+
+	for i := 0; i < 5; i++ {
+		s.takeNextPending()
+	}
+
+	s.markComplete(0)
+	s.markComplete(1)
+	s.markComplete(3)
+	s.markValidated(0)
+	s.markValidated(1)
+	s.markValidated(3)
+
+	// 2 is still executing, 3 completed speculatively and has to be executed again after it
+	require.Equal(t, []int{2, 3, 4, 5}, s.serialFallbackOrder())
+
+	s.markComplete(2)
+	require.Equal(t, []int{2, 3, 4, 5}, s.serialFallbackOrder(), "2 isn't validated yet")
+
+	s.markValidated(2)
+	require.Equal(t, []int{4, 5}, s.serialFallbackOrder())
+}
+
+func sortedMaxAllComplete(l []int) int {
+	tx := 0
+	for tx < len(l) && l[tx] == tx {
+		tx++
+	}
+
+	return tx - 1
+}
+
+func FuzzCompleteSet(f *testing.F) {
+	f.Add([]byte{3, 1, 0, 2, 0x81, 1})
+	f.Add([]byte{0, 1, 2, 3, 0x80, 0x82, 0x7f, 64, 63})
+
+	f.Fuzz(func(t *testing.T, ops []byte) {
+		// each op adds the task in its low bits, or removes it if the high bit is set
+		set := newCompleteSet(100)
+
+		var sorted []int
+
+		for _, op := range ops {
+			tx := int(op & 0x7f)
+			if op&0x80 != 0 {
+				set.remove(tx)
+
+				if slices.Contains(sorted, tx) {
+					sorted = removeFromList(sorted, tx, true)
+				}
+			} else {
+				set.add(tx)
+				sorted = insertInList(sorted, tx)
+			}
+
+			for x := 0; x < 128; x++ {
+				if set.has(x) != slices.Contains(sorted, x) {
+					t.Fatalf("membership of task %d mismatch: have %v", x, set.has(x))
+				}
+			}
+
+			if set.len() != len(sorted) {
+				t.Fatalf("count mismatch: have %d, want %d", set.len(), len(sorted))
+			}
+
+			if have, want := set.watermark-1, sortedMaxAllComplete(sorted); have != want {
+				t.Fatalf("max all complete mismatch: have %d, want %d", have, want)
+			}
+
+			if have := set.tasks(); !slices.Equal(have, sorted) {
+				t.Fatalf("tasks mismatch: have %v, want %v", have, sorted)
+			}
+		}
+	})
+}
+
+func BenchmarkOutOfOrderCompletion(b *testing.B) {
+	const numTasks = 10000
+
+	// tasks complete in random order, with the commit point checked after each completion
+	order := rand.New(rand.NewSource(1)).Perm(numTasks)
+
+	b.Run("SortedSlice", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			var complete []int
+
+			for _, tx := range order {
+				complete = insertInList(complete, tx)
+				sortedMaxAllComplete(complete)
+			}
+		}
+	})
+
+	b.Run("Bitmap", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			complete := newCompleteSet(numTasks)
+
+			for _, tx := range order {
+				complete.add(tx)
+				_ = complete.watermark - 1
+			}
+		}
+	})
+}
+
+func BenchmarkSchedule(b *testing.B) {
+	const numTasks = 10000
+
+	// all tasks are dispatched before any completes, they complete in random order
+	order := rand.New(rand.NewSource(1)).Perm(numTasks)
+
+	schedule := func(s *taskStatusManager) {
+		for s.takeNextPending() != -1 {
+		}
+
+		for _, tx := range order {
+			s.markComplete(tx)
+		}
+
+		if s.countComplete() != numTasks {
+			b.Fatalf("%d of %d tasks complete", s.countComplete(), numTasks)
+		}
+	}
+
+	b.Run("Growing", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			s := makeStatusManager(numTasks)
+			s.inProgress, s.completion = nil, nil
+
+			schedule(&s)
+		}
+	})
+
+	b.Run("Preallocated", func(b *testing.B) {
+		b.ReportAllocs()
+
+		for i := 0; i < b.N; i++ {
+			s := makeStatusManager(numTasks)
+
+			schedule(&s)
+		}
+	})
+}
+
+func TestRevalidationRangeFor(t *testing.T) {
+	t.Parallel()
+
+	// getCommonAddress wraps around, key(100) could be the same as a lower key
+	key := func(i int) Key { return NewAddressKey(common.BigToAddress(big.NewInt(int64(i)))) }
+
+	s := makeStatusManager(5)
+	io := MakeTxnInputOutput(5)
+
+	for tx := 0; tx < 5; tx++ {
+		require.Equal(t, tx, s.takeNextPending())
+		s.markComplete(tx)
+		io.recordRead(tx, []ReadDescriptor{{Path: key(tx)}, {Path: key(100)}})
+	}
+
+	require.Equal(t, []int{2, 3, 4}, s.getRevalidationRange(2))
+
+	// nothing written, or written keys no later task read
+	require.Empty(t, s.getRevalidationRangeFor(2, nil, io))
+	require.Empty(t, s.getRevalidationRangeFor(2, []WriteDescriptor{{Path: key(0)}, {Path: key(1)}, {Path: key(5)}}, io))
+
+	// a single conflicting read revalidates the whole range
+	require.Equal(t, []int{2, 3, 4}, s.getRevalidationRangeFor(2, []WriteDescriptor{{Path: key(5)}, {Path: key(4)}}, io))
+	require.Equal(t, []int{2, 3, 4}, s.getRevalidationRangeFor(2, []WriteDescriptor{{Path: key(100)}}, io))
+}
+
+func TestTaskDuration(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(3)
+
+	now := time.Unix(0, 0)
+	s.now = func() time.Time { return now }
+
+	require.Equal(t, 0, s.takeNextPending())
+	require.Equal(t, 1, s.takeNextPending())
+
+	now = now.Add(10 * time.Millisecond)
+	s.markComplete(0)
+
+	// 1 aborts and is executed again
+	now = now.Add(5 * time.Millisecond)
+	s.clearInProgress(1)
+	s.pushPending(1)
+
+	require.Equal(t, 1, s.takeNextPending())
+	require.Equal(t, 2, s.takeNextPending())
+
+	now = now.Add(20 * time.Millisecond)
+	s.markComplete(1)
+
+	require.Equal(t, 10*time.Millisecond, s.taskDuration(0))
+	require.Equal(t, 35*time.Millisecond, s.taskDuration(1))
+
+	// the execution of 2 is still in progress
+	require.Equal(t, time.Duration(0), s.taskDuration(2))
+}
+
+func TestReportError(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(4)
+
+	require.Equal(t, 0, s.takeNextPending())
+	require.Equal(t, 1, s.takeNextPending())
+	require.NoError(t, s.firstError())
+
+	errFailed := errors.New("failed")
+	s.reportError(1, errFailed)
+	s.reportError(0, errors.New("later"))
+
+	require.Equal(t, -1, s.takeNextPending())
+	require.Equal(t, SchedFailed, s.schedulingState())
+
+	require.ErrorIs(t, s.firstError(), errFailed)
+	require.EqualError(t, s.firstError(), "task 1: failed")
+
+	// tasks already in progress can still finish
+	s.markComplete(0)
+	s.markComplete(1)
+	require.Equal(t, SchedFailed, s.schedulingState())
+}
+
+func TestForcedSerial(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(4)
+	s.setMaxIncarnations(1)
+
+	require.Equal(t, 0, s.takeNextPending())
+	require.Equal(t, 1, s.takeNextPending())
+	require.Equal(t, 2, s.takeNextPending())
+
+	// 2 is aborted once, which is within the limit
+	s.clearInProgress(2)
+	s.pushPending(2)
+	require.Empty(t, s.forcedSerial())
+	require.Equal(t, 2, s.takeNextPending())
+
+	// the second abort exceeds it
+	s.clearInProgress(2)
+	s.pushPending(2)
+	require.Equal(t, []int{2}, s.forcedSerial())
+
+	// 2 waits for the tasks before it, 3 isn't started meanwhile
+	require.Equal(t, -1, s.takeNextPending())
+
+	s.markComplete(0)
+	require.Equal(t, -1, s.takeNextPending())
+
+	s.markComplete(1)
+	require.Equal(t, 2, s.takeNextPending())
+
+	// nothing runs alongside it
+	require.Equal(t, -1, s.takeNextPending())
+
+	s.markComplete(2)
+	require.Equal(t, 3, s.takeNextPending())
+}
+
+func TestProgressPercent(t *testing.T) {
+	t.Parallel()
+
+	s := makeStatusManager(4)
+	require.Equal(t, 0.0, s.progressPercent())
+
+	for i := 0; i < 4; i++ {
+		require.Equal(t, i, s.takeNextPending())
+	}
+
+	// 1 can't be committed before 0
+	s.markComplete(1)
+	require.Equal(t, 0.0, s.progressPercent())
+
+	s.markComplete(0)
+	require.Equal(t, 50.0, s.progressPercent())
+
+	s.markComplete(2)
+	require.Equal(t, 75.0, s.progressPercent())
+
+	// 1 is executed again
+	s.clearComplete(1)
+	s.pushPending(1)
+	require.Equal(t, 25.0, s.progressPercent())
+
+	s.markComplete(3)
+	require.Equal(t, 1, s.takeNextPending())
+	s.markComplete(1)
+	require.Equal(t, 100.0, s.progressPercent())
+
+	empty := makeStatusManager(0)
+	require.Equal(t, 100.0, empty.progressPercent())
+}
@@ -1,5 +1,12 @@
 package blockstm
 
+import (
+	"bytes"
+	"fmt"
+	"slices"
+	"strings"
+)
+
 const (
 	ReadKindMap     = 0
 	ReadKindStorage = 1
@@ -67,6 +74,47 @@ func (io *TxnInputOutput) HasWritten(txnIdx int, k Key) bool {
 	return ok
 }
 
+// rwSetSizes returns the number of reads and writes recorded for a task. The writes are counted from the
+// entire write set, a large one makes conflicts with later tasks likely.
+func (io *TxnInputOutput) rwSetSizes(txnIdx int) (reads, writes int) {
+	return len(io.inputs[txnIdx]), len(io.allOutputs[txnIdx])
+}
+
+// ReadSetDump returns the recorded read set of a task in a canonical form, one read per line sorted by key,
+// so the reads of an execution and a validation pass can be diffed to find the conflicting key. A read is
+// dumped as the key and the version it read from the MVHashMap, or "storage" if it read from the state:
+//
+//	0x<address> tx2.0
+//	0x<address>/<slot> storage
+//	0x<address>#<subpath> tx5.1
+func (io *TxnInputOutput) ReadSetDump(txnIdx int) string {
+	reads := slices.Clone(io.inputs[txnIdx])
+	slices.SortStableFunc(reads, func(a, b ReadDescriptor) int {
+		return bytes.Compare(a.Path[:], b.Path[:])
+	})
+
+	var sb strings.Builder
+
+	for _, rd := range reads {
+		sb.WriteString(rd.Path.GetAddress().Hex())
+
+		switch {
+		case rd.Path.IsState():
+			sb.WriteString("/" + rd.Path.GetStateKey().Hex())
+		case rd.Path.IsSubpath():
+			fmt.Fprintf(&sb, "#%d", rd.Path.GetSubpath())
+		}
+
+		if rd.Kind == ReadKindStorage {
+			sb.WriteString(" storage\n")
+		} else {
+			fmt.Fprintf(&sb, " tx%d.%d\n", rd.V.TxnIndex, rd.V.Incarnation)
+		}
+	}
+
+	return sb.String()
+}
+
 func MakeTxnInputOutput(numTx int) *TxnInputOutput {
 	return &TxnInputOutput{
 		inputs:     make([]TxnInput, numTx),
@@ -0,0 +1,88 @@
+package blockstm
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+func TestRWSetSizes(t *testing.T) {
+	t.Parallel()
+
+	key := func(i int) Key { return NewAddressKey(getCommonAddress(i)) }
+
+	io := MakeTxnInputOutput(2)
+
+	reads, writes := io.rwSetSizes(0)
+	require.Equal(t, 0, reads)
+	require.Equal(t, 0, writes)
+
+	io.recordRead(0, []ReadDescriptor{{Path: key(1)}, {Path: key(2)}, {Path: key(3)}})
+	io.recordWrite(0, []WriteDescriptor{{Path: key(1)}})
+	io.recordAllWrite(0, []WriteDescriptor{{Path: key(1)}, {Path: key(4)}})
+
+	reads, writes = io.rwSetSizes(0)
+	require.Equal(t, 3, reads)
+	require.Equal(t, 2, writes, "all writes are counted, not only the validated ones")
+
+	// a new incarnation replaces the sets
+	io.recordRead(0, []ReadDescriptor{{Path: key(1)}})
+	io.recordAllWrite(0, nil)
+
+	reads, writes = io.rwSetSizes(0)
+	require.Equal(t, 1, reads)
+	require.Equal(t, 0, writes)
+
+	reads, writes = io.rwSetSizes(1)
+	require.Equal(t, 0, reads)
+	require.Equal(t, 0, writes)
+}
+
+func TestReadSetDump(t *testing.T) {
+	t.Parallel()
+
+	var (
+		a = common.HexToAddress("0x00000000000000000000000000000000000000aa")
+		b = common.HexToAddress("0x00000000000000000000000000000000000000bb")
+	)
+
+	reads := []ReadDescriptor{
+		{Path: NewStateKey(b, common.HexToHash("0x02")), Kind: ReadKindStorage, V: Version{TxnIndex: -1, Incarnation: -1}},
+		{Path: NewSubpathKey(a, 1), Kind: ReadKindMap, V: Version{TxnIndex: 3, Incarnation: 1}},
+		{Path: NewAddressKey(b), Kind: ReadKindMap, V: Version{TxnIndex: 0, Incarnation: 0}},
+		{Path: NewAddressKey(a), Kind: ReadKindStorage, V: Version{TxnIndex: -1, Incarnation: -1}},
+	}
+
+	io := MakeTxnInputOutput(2)
+	io.recordRead(1, reads)
+
+	want := "" +
+		"0x00000000000000000000000000000000000000AA storage\n" +
+		"0x00000000000000000000000000000000000000AA#1 tx3.1\n" +
+		"0x00000000000000000000000000000000000000bb tx0.0\n" +
+		"0x00000000000000000000000000000000000000bb/0x0000000000000000000000000000000000000000000000000000000000000002 storage\n"
+
+	require.Equal(t, "", io.ReadSetDump(0))
+	require.Equal(t, want, io.ReadSetDump(1))
+	require.Equal(t, NewStateKey(b, common.HexToHash("0x02")), io.ReadSet(1)[0].Path, "the recorded read set isn't sorted")
+
+	// the dump doesn't depend on the order of the reads
+	for i := 0; i < 3; i++ {
+		reads[i], reads[3-i] = reads[3-i], reads[i]
+		io.recordRead(1, reads)
+		require.Equal(t, want, io.ReadSetDump(1))
+	}
+
+	// a different version of a read changes its line only
+	for i := range reads {
+		if reads[i].Path == NewSubpathKey(a, 1) {
+			reads[i].V.Incarnation = 2
+		}
+	}
+
+	io.recordRead(1, reads)
+	require.Equal(t, strings.Replace(want, "tx3.1", "tx3.2", 1), io.ReadSetDump(1))
+}
@@ -77,6 +77,7 @@ type ExecutionTask struct {
 	result                     *ExecutionResult
 	shouldDelayFeeCal          *bool
 	shouldRerunWithoutFeeDelay bool
+	flagged                    bool // whether the last execution ran an opcode denied by the vm.OpcodePolicy
 	sender                     common.Address
 	totalUsedGas               *uint64
 	receipts                   *types.Receipts
@@ -139,6 +140,8 @@ func (task *ExecutionTask) Execute(mvh *blockstm.MVHashMap, incarnation int) (er
 		task.result, err = ApplyMessage(evm, &task.msg, new(GasPool).AddGas(task.gasLimit), nil)
 	}
 
+	task.flagged = len(evm.Interpreter().FlaggedOpcodes()) > 0
+
 	if task.statedb.HadInvalidRead() || err != nil {
 		err = blockstm.ErrExecAbortError{Dependency: task.statedb.DepTxIndex(), OriginError: err}
 		return
@@ -169,6 +172,10 @@ func (task *ExecutionTask) Hash() common.Hash {
 	return task.tx.Hash()
 }
 
+func (task *ExecutionTask) Flagged() bool {
+	return task.flagged
+}
+
 func (task *ExecutionTask) Dependencies() []int {
 	return task.dependencies
 }
@@ -254,6 +261,9 @@ func (task *ExecutionTask) Settle() {
 
 var parallelizabilityTimer = metrics.NewRegisteredTimer("block/parallelizability", nil)
 
+// maxIncarnationsPerTx bounds the wasted executions of a tx, a tx exceeding them is executed alone
+const maxIncarnationsPerTx = 8
+
 // Process processes the state changes according to the Ethereum rules by running
 // the transaction messages using the statedb and applying any rewards to both
 // the processor (coinbase) and any included uncles.
@@ -341,19 +351,15 @@ func (p *ParallelStateProcessor) Process(block *types.Block, statedb *state.Stat
 
 	backupStateDB := statedb.Copy()
 
+	execOpts := []blockstm.ExecutorOption{
+		blockstm.WithMaxIncarnations(maxIncarnationsPerTx),
+	}
+
 	profile := false
-	result, err := blockstm.ExecuteParallel(tasks, profile, metadata, p.bc.parallelSpeculativeProcesses, interruptCtx)
+	result, err := blockstm.ExecuteParallel(tasks, profile, metadata, p.bc.parallelSpeculativeProcesses, interruptCtx, execOpts...)
 
 	if err == nil && profile && result.Deps != nil {
-		_, weight := result.Deps.LongestPath(*result.Stats)
-
-		serialWeight := uint64(0)
-
-		for i := 0; i < len(result.Deps.GetVertices()); i++ {
-			serialWeight += (*result.Stats)[i].End - (*result.Stats)[i].Start
-		}
-
-		parallelizabilityTimer.Update(time.Duration(serialWeight * 100 / weight))
+		parallelizabilityTimer.Update(time.Duration(result.Deps.TheoreticalSpeedup(*result.Stats) * 100))
 	}
 
 	for _, task := range tasks {
@@ -376,7 +382,7 @@ func (p *ParallelStateProcessor) Process(block *types.Block, statedb *state.Stat
 				t.totalUsedGas = usedGas
 			}
 
-			_, err = blockstm.ExecuteParallel(tasks, false, metadata, p.bc.parallelSpeculativeProcesses, interruptCtx)
+			_, err = blockstm.ExecuteParallel(tasks, false, metadata, p.bc.parallelSpeculativeProcesses, interruptCtx, execOpts...)
 
 			break
 		}
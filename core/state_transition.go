@@ -544,13 +544,14 @@ func (st *StateTransition) TransitionDb(interruptCtx context.Context) (*Executio
 }
 
 func (st *StateTransition) refundGas(refundQuotient uint64) uint64 {
-	// Apply refund counter, capped to a refund quotient
-	refund := st.gasUsed() / refundQuotient
-	if refund > st.state.GetRefund() {
-		refund = st.state.GetRefund()
-	}
+	// Apply refund counter, capped to a refund quotient, unless the raw gas
+	// consumption is estimated
+	var refund uint64
 
-	st.gasRemaining += refund
+	if !st.evm.Config.DisableRefunds {
+		refund = st.evm.Interpreter().ApplyRefundCap(st.state.GetRefund(), st.gasUsed()/refundQuotient)
+		st.gasRemaining += refund
+	}
 
 	// Return ETH for remaining gas, exchanged at the original rate.
 	remaining := new(big.Int).Mul(new(big.Int).SetUint64(st.gasRemaining), st.msg.GasPrice)
@@ -0,0 +1,173 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestDisableRefunds(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0x1000")
+		contract = common.HexToAddress("0x2000")
+	)
+
+	// apply runs a tx clearing two storage slots, which earns a refund
+	apply := func(cfg vm.Config) *ExecutionResult {
+		statedb, _ := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		statedb.AddBalance(sender, big.NewInt(params.Ether))
+		// sstore(0, 0) sstore(1, 0)
+		statedb.SetCode(contract, []byte{byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.SSTORE), byte(vm.PUSH1), 0, byte(vm.PUSH1), 1, byte(vm.SSTORE), byte(vm.STOP)})
+		statedb.SetState(contract, common.Hash{0}, common.Hash{1})
+		statedb.SetState(contract, common.Hash{1}, common.Hash{1})
+		statedb.Finalise(true)
+
+		blockContext := vm.BlockContext{
+			CanTransfer: CanTransfer,
+			Transfer:    Transfer,
+			BlockNumber: big.NewInt(1),
+			GasLimit:    10_000_000,
+			BaseFee:     new(big.Int),
+		}
+		msg := &Message{
+			To:                &contract,
+			From:              sender,
+			Value:             new(big.Int),
+			GasLimit:          100_000,
+			GasPrice:          new(big.Int),
+			GasFeeCap:         new(big.Int),
+			GasTipCap:         new(big.Int),
+			SkipAccountChecks: true,
+		}
+
+		evm := vm.NewEVM(blockContext, NewEVMTxContext(msg), statedb, params.AllEthashProtocolChanges, cfg)
+
+		result, err := ApplyMessage(evm, msg, new(GasPool).AddGas(blockContext.GasLimit), nil)
+		if err != nil {
+			t.Fatalf("failed to apply message: %v", err)
+		}
+
+		if result.Err != nil {
+			t.Fatalf("execution failed: %v", result.Err)
+		}
+
+		return result
+	}
+
+	refunded := apply(vm.Config{})
+	if refunded.RefundedGas == 0 {
+		t.Fatalf("clearing storage didn't earn a refund")
+	}
+
+	raw := apply(vm.Config{DisableRefunds: true})
+	if raw.RefundedGas != 0 {
+		t.Errorf("refund applied with refunds disabled: %d", raw.RefundedGas)
+	}
+
+	if want := refunded.UsedGas + refunded.RefundedGas; raw.UsedGas != want {
+		t.Errorf("gas used mismatch: have %d, want %d", raw.UsedGas, want)
+	}
+}
+
+func TestRefundCapped(t *testing.T) {
+	var (
+		sender   = common.HexToAddress("0x1000")
+		contract = common.HexToAddress("0x2000")
+	)
+
+	// apply runs a tx clearing the given number of storage slots, each earning a refund
+	apply := func(slots int) (*ExecutionResult, *vm.EVM) {
+		statedb, _ := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+		statedb.AddBalance(sender, big.NewInt(params.Ether))
+
+		var code []byte
+
+		for i := 0; i < slots; i++ {
+			// sstore(i, 0)
+			code = append(code, byte(vm.PUSH1), 0, byte(vm.PUSH1), byte(i), byte(vm.SSTORE))
+			statedb.SetState(contract, common.Hash{31: byte(i)}, common.Hash{1})
+		}
+
+		statedb.SetCode(contract, append(code, byte(vm.STOP)))
+		statedb.Finalise(true)
+
+		blockContext := vm.BlockContext{
+			CanTransfer: CanTransfer,
+			Transfer:    Transfer,
+			BlockNumber: big.NewInt(1),
+			GasLimit:    10_000_000,
+			BaseFee:     new(big.Int),
+		}
+		msg := &Message{
+			To:                &contract,
+			From:              sender,
+			Value:             new(big.Int),
+			GasLimit:          100_000,
+			GasPrice:          new(big.Int),
+			GasFeeCap:         new(big.Int),
+			GasTipCap:         new(big.Int),
+			SkipAccountChecks: true,
+		}
+
+		evm := vm.NewEVM(blockContext, NewEVMTxContext(msg), statedb, params.AllEthashProtocolChanges, vm.Config{})
+
+		result, err := ApplyMessage(evm, msg, new(GasPool).AddGas(blockContext.GasLimit), nil)
+		if err != nil {
+			t.Fatalf("failed to apply message: %v", err)
+		}
+
+		if result.Err != nil {
+			t.Fatalf("execution failed: %v", result.Err)
+		}
+
+		return result, evm
+	}
+
+	// a single cleared slot stays below a fifth of the gas used
+	result, evm := apply(1)
+	if capped, amount := evm.Interpreter().RefundCapped(); capped || amount != 0 {
+		t.Errorf("refund of one slot capped by %d", amount)
+	}
+
+	if result.RefundedGas != params.SstoreClearsScheduleRefundEIP3529 {
+		t.Errorf("refund of one slot: have %d, want %d", result.RefundedGas, params.SstoreClearsScheduleRefundEIP3529)
+	}
+
+	// the refunds of four cleared slots exceed it
+	result, evm = apply(4)
+
+	capped, amount := evm.Interpreter().RefundCapped()
+	if !capped {
+		t.Fatalf("refund of four slots not capped")
+	}
+
+	if maxRefund := (result.UsedGas + result.RefundedGas) / params.RefundQuotientEIP3529; result.RefundedGas != maxRefund {
+		t.Errorf("capped refund: have %d, want %d", result.RefundedGas, maxRefund)
+	}
+
+	if want := 4*params.SstoreClearsScheduleRefundEIP3529 - result.RefundedGas; amount != want {
+		t.Errorf("withheld refund: have %d, want %d", amount, want)
+	}
+}
@@ -17,10 +17,14 @@
 package vm
 
 import (
+	"bytes"
+	"math/big"
 	"math/bits"
 	"testing"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/holiman/uint256"
 )
 
 func TestJumpDestAnalysis(t *testing.T) {
@@ -59,6 +63,54 @@ func TestJumpDestAnalysis(t *testing.T) {
 	}
 }
 
+func TestJumpdestCache(t *testing.T) {
+	// the 0x5b within the push data at 1 isn't a valid destination, the one at 3 is
+	code := []byte{byte(PUSH1), byte(JUMPDEST), byte(POP), byte(JUMPDEST), byte(STOP)}
+	hash := crypto.Keccak256Hash(code)
+	addr := common.BytesToAddress([]byte("contract"))
+
+	newContract := func() *Contract {
+		contract := NewContract(AccountRef(common.Address{}), AccountRef(addr), new(big.Int), 0)
+		contract.SetCallCode(&addr, hash, code)
+
+		return contract
+	}
+
+	jumpdestCache.Remove(hash)
+
+	for run := 0; run < 2; run++ {
+		contract := newContract()
+
+		if contract.validJumpdest(uint256.NewInt(1)) {
+			t.Errorf("run %d: jump into push data allowed", run)
+		}
+
+		if !contract.validJumpdest(uint256.NewInt(3)) {
+			t.Errorf("run %d: jump to JUMPDEST rejected", run)
+		}
+
+		cached, ok := jumpdestCache.Peek(hash)
+		if !ok {
+			t.Fatalf("run %d: analysis not cached", run)
+		}
+
+		if !bytes.Equal(cached, codeBitmap(code)) {
+			t.Errorf("run %d: cached analysis mismatch: have %x, want %x", run, cached, codeBitmap(code))
+		}
+	}
+
+	// contracts sharing the code hash are served from the cache
+	poisoned := make(bitvec, len(code)/8+1+4)
+	poisoned.set1(3)
+	jumpdestCache.Add(hash, poisoned)
+
+	if newContract().validJumpdest(uint256.NewInt(3)) {
+		t.Errorf("analysis not read from the cache")
+	}
+
+	jumpdestCache.Remove(hash)
+}
+
 const analysisCodeSize = 1200 * 1024
 
 func BenchmarkJumpdestAnalysis_1200k(bench *testing.B) {
@@ -84,6 +136,34 @@ func BenchmarkJumpdestHashing_1200k(bench *testing.B) {
 	bench.StopTimer()
 }
 
+func BenchmarkJumpdestCache(bench *testing.B) {
+	code := make([]byte, 24*1024)
+	for i := range code {
+		code[i] = byte(PUSH1)
+	}
+
+	hash := crypto.Keccak256Hash(code)
+	addr := common.BytesToAddress([]byte("contract"))
+
+	// every iteration is a new run of the same contract
+	run := func(b *testing.B, purge bool) {
+		for i := 0; i < b.N; i++ {
+			if purge {
+				jumpdestCache.Remove(hash)
+			}
+
+			contract := NewContract(AccountRef(common.Address{}), AccountRef(addr), new(big.Int), 0)
+			contract.SetCallCode(&addr, hash, code)
+			contract.isCode(0)
+		}
+	}
+
+	bench.Run("Uncached", func(b *testing.B) { run(b, true) })
+	bench.Run("Cached", func(b *testing.B) { run(b, false) })
+
+	jumpdestCache.Remove(hash)
+}
+
 func BenchmarkJumpdestOpAnalysis(bench *testing.B) {
 	var op OpCode
 
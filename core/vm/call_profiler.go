@@ -0,0 +1,134 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// callFrame is a call of the profiled call tree which has not returned yet.
+type callFrame struct {
+	addr     common.Address
+	start    time.Time
+	children time.Duration // total time spent in the nested calls of the frame
+}
+
+// CallProfiler records the time spent in every frame of the call tree, keyed
+// by the code addresses of the call stack, and exports it in the folded stack
+// format consumed by flamegraph tools.
+//
+// The profiler is driven by the OnCallEnter and OnCallExit hooks of the Config,
+// which are only invoked for nested calls: the top-level call has to be wrapped
+// by the caller with Enter and Exit.
+type CallProfiler struct {
+	stack []callFrame
+	self  map[string]time.Duration // self time of the frames per folded stack
+
+	now func() time.Time
+}
+
+// NewCallProfiler creates an empty call profiler.
+func NewCallProfiler() *CallProfiler {
+	return &CallProfiler{
+		self: make(map[string]time.Duration),
+		now:  time.Now,
+	}
+}
+
+// Hook sets the call frame hooks of the config to the profiler.
+func (p *CallProfiler) Hook(cfg *Config) {
+	cfg.OnCallEnter = p.OnCallEnter
+	cfg.OnCallExit = p.OnCallExit
+}
+
+// Enter opens a frame executing the code of addr on top of the current stack.
+func (p *CallProfiler) Enter(addr common.Address) {
+	p.stack = append(p.stack, callFrame{addr: addr, start: p.now()})
+}
+
+// Exit closes the innermost open frame, exits without an open frame are ignored.
+func (p *CallProfiler) Exit() {
+	if len(p.stack) == 0 {
+		return
+	}
+
+	top := p.stack[len(p.stack)-1]
+	elapsed := p.now().Sub(top.start)
+
+	p.self[p.folded()] += elapsed - top.children
+	p.stack = p.stack[:len(p.stack)-1]
+
+	if len(p.stack) > 0 {
+		p.stack[len(p.stack)-1].children += elapsed
+	}
+}
+
+// OnCallEnter implements the Config.OnCallEnter hook.
+func (p *CallProfiler) OnCallEnter(typ OpCode, to common.Address, input []byte, value *big.Int, gas uint64) {
+	p.Enter(to)
+}
+
+// OnCallExit implements the Config.OnCallExit hook.
+func (p *CallProfiler) OnCallExit(typ OpCode, to common.Address, gasUsed uint64, err error) {
+	p.Exit()
+}
+
+// Reset drops all the recorded frames.
+func (p *CallProfiler) Reset() {
+	p.stack = p.stack[:0]
+	p.self = make(map[string]time.Duration)
+}
+
+// folded returns the current call stack, outermost frame first, separated by
+// semicolons.
+func (p *CallProfiler) folded() string {
+	frames := make([]string, len(p.stack))
+	for i, frame := range p.stack {
+		frames[i] = frame.addr.Hex()
+	}
+
+	return strings.Join(frames, ";")
+}
+
+// WriteFolded writes one line per recorded call stack with the self time of its
+// innermost frame in nanoseconds, sorted by stack. Frames still open are not
+// part of the output.
+func (p *CallProfiler) WriteFolded(w io.Writer) error {
+	stacks := make([]string, 0, len(p.self))
+	for stack := range p.self {
+		stacks = append(stacks, stack)
+	}
+
+	slices.Sort(stacks)
+
+	bw := bufio.NewWriter(w)
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(bw, "%s %d\n", stack, p.self[stack].Nanoseconds()); err != nil {
+			return err
+		}
+	}
+
+	return bw.Flush()
+}
@@ -20,9 +20,17 @@ import (
 	"math/big"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/lru"
 	"github.com/holiman/uint256"
 )
 
+// jumpdestCacheSize is the number of contracts whose JUMPDEST analysis is kept across runs
+const jumpdestCacheSize = 1024
+
+// jumpdestCache holds the JUMPDEST analysis of recently executed contracts by code hash, so contracts
+// executed many times in a block are only analysed once. The cached bitmaps are never modified.
+var jumpdestCache = lru.NewCache[common.Hash, bitvec](jumpdestCacheSize)
+
 // ContractRef is a reference to the contract's backing object
 type ContractRef interface {
 	Address() common.Address
@@ -111,9 +119,14 @@ func (c *Contract) isCode(udest uint64) bool {
 		// Does parent context have the analysis?
 		analysis, exist := c.jumpdests[c.CodeHash]
 		if !exist {
-			// Do the analysis and save in parent context
+			// Was it analysed by an earlier run? Otherwise do the analysis, and
+			// save it in parent context and across runs
 			// We do not need to store it in c.analysis
-			analysis = codeBitmap(c.Code)
+			if analysis, exist = jumpdestCache.Get(c.CodeHash); !exist {
+				analysis = codeBitmap(c.Code)
+				jumpdestCache.Add(c.CodeHash, analysis)
+			}
+
 			c.jumpdests[c.CodeHash] = analysis
 		}
 		// Also stash it in current contract for faster access
@@ -20,11 +20,13 @@ import (
 	"bytes"
 	"encoding/json"
 	"fmt"
+	"math/big"
 	"os"
 	"testing"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
 )
 
 // precompiledTest defines the input/output pairs for precompiled contract tests.
@@ -432,3 +434,40 @@ func TestPrecompiledP256Verify(t *testing.T) {
 
 	testJson("p256Verify", "100", t)
 }
+
+func TestPrecompileOverride(t *testing.T) {
+	var (
+		pairing = common.BytesToAddress([]byte{8})
+		mocked  = common.LeftPadBytes([]byte{1}, 32)
+		input   []byte
+	)
+
+	override := func(in []byte) ([]byte, error) {
+		input = in
+		return mocked, nil
+	}
+
+	statedb := newTestState(nil)
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{
+		PrecompileOverride: map[common.Address]func([]byte) ([]byte, error){pairing: override},
+	})
+
+	// An invalid pairing input makes the real precompile fail
+	ret, leftOverGas, err := evm.Call(AccountRef(common.Address{}), pairing, []byte{0xde, 0xad}, 100000, new(big.Int), nil)
+	if err != nil {
+		t.Fatalf("overridden precompile failed: %v", err)
+	}
+
+	if !bytes.Equal(ret, mocked) {
+		t.Errorf("unexpected output: have %x, want %x", ret, mocked)
+	}
+
+	if !bytes.Equal(input, []byte{0xde, 0xad}) {
+		t.Errorf("unexpected input passed to override: %x", input)
+	}
+
+	// Gas is charged as for the real precompile
+	if want := 100000 - (&bn256PairingIstanbul{}).RequiredGas([]byte{0xde, 0xad}); leftOverGas != want {
+		t.Errorf("unexpected gas left: have %d, want %d", leftOverGas, want)
+	}
+}
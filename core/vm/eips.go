@@ -229,6 +229,8 @@ func opBaseFee(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]
 	baseFee, _ := uint256.FromBig(interpreter.evm.Context.BaseFee)
 	scope.Stack.push(baseFee)
 
+	interpreter.baseFeeReads++
+
 	return nil, nil
 }
 
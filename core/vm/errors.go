@@ -37,6 +37,11 @@ var (
 	ErrGasUintOverflow          = errors.New("gas uint64 overflow")
 	ErrInvalidCode              = errors.New("invalid code: must not begin with 0xef")
 	ErrNonceUintOverflow        = errors.New("nonce uint64 overflow")
+	ErrReturnDataTooLarge       = errors.New("return data too large")
+	ErrLogDataTooLarge          = errors.New("log data too large")
+	ErrOpcodeOverride           = errors.New("cannot override a defined opcode on mainnet")
+	ErrSubCallsDisabled         = errors.New("sub-calls disabled")
+	ErrWatchedSlot              = errors.New("watched storage slot accessed")
 
 	// errStopToken is an internal token indicating interpreter loop termination,
 	// never returned to outside callers.
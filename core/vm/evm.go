@@ -55,10 +55,26 @@ func (evm *EVM) precompile(addr common.Address) (PrecompiledContract, bool) {
 	}
 
 	p, ok := precompiles[addr]
+	if ok {
+		if override, found := evm.Config.PrecompileOverride[addr]; found {
+			p = &overriddenPrecompile{PrecompiledContract: p, run: override}
+		}
+	}
 
 	return p, ok
 }
 
+// overriddenPrecompile charges the gas of the wrapped precompile but runs the
+// override configured in Config.PrecompileOverride instead.
+type overriddenPrecompile struct {
+	PrecompiledContract
+	run func(input []byte) ([]byte, error)
+}
+
+func (p *overriddenPrecompile) Run(input []byte) ([]byte, error) {
+	return p.run(input)
+}
+
 // BlockContext provides the EVM with auxiliary information. Once provided
 // it shouldn't be modified.
 type BlockContext struct {
@@ -81,6 +97,74 @@ type BlockContext struct {
 	Random      *common.Hash   // Provides information for PREVRANDAO
 }
 
+// BlockEnv is a snapshot of the block information read by the environment opcodes. An EVM
+// configured with Config.EnvSnapshot uses it instead of the block context it was created with,
+// so re-executions return the same results regardless of the chain head.
+type BlockEnv struct {
+	Coinbase    common.Address
+	GasLimit    uint64
+	BlockNumber *big.Int
+	Time        uint64
+	Difficulty  *big.Int
+	BaseFee     *big.Int
+	BlobBaseFee *big.Int
+	Random      *common.Hash
+
+	// BlockHashes provides the results of BLOCKHASH, missing blocks return the zero hash
+	BlockHashes map[uint64]common.Hash
+}
+
+// NewBlockEnv returns a snapshot of the block information of ctx. The hashes of the
+// given blocks are read through the GetHash of ctx.
+func NewBlockEnv(ctx BlockContext, hashes ...uint64) *BlockEnv {
+	env := &BlockEnv{
+		Coinbase:    ctx.Coinbase,
+		GasLimit:    ctx.GasLimit,
+		BlockNumber: copyBig(ctx.BlockNumber),
+		Time:        ctx.Time,
+		Difficulty:  copyBig(ctx.Difficulty),
+		BaseFee:     copyBig(ctx.BaseFee),
+		BlobBaseFee: copyBig(ctx.BlobBaseFee),
+		BlockHashes: make(map[uint64]common.Hash, len(hashes)),
+	}
+
+	if ctx.Random != nil {
+		random := *ctx.Random
+		env.Random = &random
+	}
+
+	for _, n := range hashes {
+		env.BlockHashes[n] = ctx.GetHash(n)
+	}
+
+	return env
+}
+
+// apply returns ctx with its block information replaced by the snapshot
+func (env *BlockEnv) apply(ctx BlockContext) BlockContext {
+	ctx.Coinbase = env.Coinbase
+	ctx.GasLimit = env.GasLimit
+	ctx.BlockNumber = copyBig(env.BlockNumber)
+	ctx.Time = env.Time
+	ctx.Difficulty = copyBig(env.Difficulty)
+	ctx.BaseFee = copyBig(env.BaseFee)
+	ctx.BlobBaseFee = copyBig(env.BlobBaseFee)
+	ctx.Random = env.Random
+	ctx.GetHash = func(n uint64) common.Hash {
+		return env.BlockHashes[n]
+	}
+
+	return ctx
+}
+
+func copyBig(x *big.Int) *big.Int {
+	if x == nil {
+		return nil
+	}
+
+	return new(big.Int).Set(x)
+}
+
 // TxContext provides the EVM with information about a transaction.
 // All fields can change between transactions.
 type TxContext struct {
@@ -125,16 +209,29 @@ type EVM struct {
 	// available gas is calculated in gasCall* according to the 63/64 rule and later
 	// applied in opCall*.
 	callGasTemp uint64
+	// callGasBreakdown holds the components of the dynamic gas of the current call, set in gasCall*
+	// along with callGasTemp
+	callGasBreakdown CallGasBreakdown
+	// noBaseFeeApplied is set if Config.NoBaseFee lowered a non-zero base fee to zero
+	noBaseFeeApplied bool
+	// stateDiff wraps the StateDB of the tx if Config.RecordStateDiff is enabled
+	stateDiff *stateDiffRecorder
 }
 
 // NewEVM returns a new EVM. The returned EVM is not thread safe and should
 // only ever be used *once*.
 func NewEVM(blockCtx BlockContext, txCtx TxContext, statedb StateDB, chainConfig *params.ChainConfig, config Config) *EVM {
+	if config.EnvSnapshot != nil {
+		blockCtx = config.EnvSnapshot.apply(blockCtx)
+	}
 	// If basefee tracking is disabled (eth_call, eth_estimateGas, etc), and no
 	// gas prices were specified, lower the basefee to 0 to avoid breaking EVM
 	// invariants (basefee < feecap)
+	noBaseFeeApplied := false
+
 	if config.NoBaseFee {
 		if txCtx.GasPrice.BitLen() == 0 {
+			noBaseFeeApplied = blockCtx.BaseFee != nil && blockCtx.BaseFee.Sign() != 0
 			blockCtx.BaseFee = new(big.Int)
 		}
 		if txCtx.BlobFeeCap != nil && txCtx.BlobFeeCap.BitLen() == 0 {
@@ -148,8 +245,11 @@ func NewEVM(blockCtx BlockContext, txCtx TxContext, statedb StateDB, chainConfig
 		Config:      config,
 		chainConfig: chainConfig,
 		chainRules:  chainConfig.Rules(blockCtx.BlockNumber, blockCtx.Random != nil, blockCtx.Time),
+
+		noBaseFeeApplied: noBaseFeeApplied,
 	}
 	evm.interpreter = NewEVMInterpreter(evm)
+	evm.recordStateDiff()
 
 	return evm
 }
@@ -159,6 +259,26 @@ func NewEVM(blockCtx BlockContext, txCtx TxContext, statedb StateDB, chainConfig
 func (evm *EVM) Reset(txCtx TxContext, statedb StateDB) {
 	evm.TxContext = txCtx
 	evm.StateDB = statedb
+	evm.recordStateDiff()
+}
+
+// recordStateDiff wraps the StateDB to record the state diff of the tx, see Config.RecordStateDiff
+func (evm *EVM) recordStateDiff() {
+	if evm.Config.RecordStateDiff {
+		evm.stateDiff = newStateDiffRecorder(evm.StateDB)
+		evm.StateDB = evm.stateDiff
+	}
+}
+
+// StateDiff returns the accounts changed by the tx so far, with their balance and nonce before and after
+// and the changed storage slots, if Config.RecordStateDiff is enabled. Changes which were reverted don't
+// show up, changes made outside the EVM, e.g. buying the gas of the tx, aren't included.
+func (evm *EVM) StateDiff() map[common.Address]*AccountDiff {
+	if evm.stateDiff == nil {
+		return nil
+	}
+
+	return evm.stateDiff.diff()
 }
 
 // Cancel cancels any running EVM operation. This may be called concurrently and
@@ -177,6 +297,26 @@ func (evm *EVM) Interpreter() *EVMInterpreter {
 	return evm.interpreter
 }
 
+// hooksCallFrames returns true if the call frame hooks have to be invoked for the
+// current frame, i.e. it was entered through a CALL or CREATE opcode.
+func (evm *EVM) hooksCallFrames() bool {
+	return evm.depth > 0 && (evm.Config.OnCallEnter != nil || evm.Config.OnCallExit != nil)
+}
+
+// enterCallFrame invokes the OnCallEnter hook with a copy of the input, as the calling opcodes pass a
+// slice of their memory which is reused once the frame returns.
+func (evm *EVM) enterCallFrame(typ OpCode, to common.Address, input []byte, value *big.Int, gas uint64) {
+	if evm.Config.OnCallEnter != nil {
+		evm.Config.OnCallEnter(typ, to, common.CopyBytes(input), value, gas)
+	}
+}
+
+func (evm *EVM) exitCallFrame(typ OpCode, to common.Address, gasUsed uint64, err error) {
+	if evm.Config.OnCallExit != nil {
+		evm.Config.OnCallExit(typ, to, gasUsed, err)
+	}
+}
+
 // Call executes the contract associated with the addr with the given input as
 // parameters. It also handles any necessary value transfer required and takes
 // the necessary steps to create accounts and reverses the state in case of an
@@ -186,6 +326,10 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 	if evm.depth > int(params.CallCreateDepth) {
 		return nil, gas, ErrDepth
 	}
+	// Fail sub-calls without executing them, see Config.NoSubCalls
+	if evm.Config.NoSubCalls && evm.depth > 0 {
+		return nil, gas, ErrSubCallsDisabled
+	}
 	// Fail if we're trying to transfer more than the available balance
 	if value.Sign() != 0 && !evm.Context.CanTransfer(evm.StateDB, caller.Address(), value) {
 		return nil, gas, ErrInsufficientBalance
@@ -208,6 +352,11 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 				}
 			}
 
+			if evm.hooksCallFrames() {
+				evm.enterCallFrame(CALL, addr, input, value, gas)
+				evm.exitCallFrame(CALL, addr, 0, nil)
+			}
+
 			return nil, gas, nil
 		}
 
@@ -232,6 +381,13 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 		}
 	}
 
+	if evm.hooksCallFrames() {
+		evm.enterCallFrame(CALL, addr, input, value, gas)
+		defer func(startGas uint64) {
+			evm.exitCallFrame(CALL, addr, startGas-gas, err)
+		}(gas)
+	}
+
 	if isPrecompile {
 		ret, gas, err = RunPrecompiledContract(p, input, gas)
 	} else {
@@ -239,6 +395,8 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 		// The contract is a scoped environment for this execution context only.
 		code := evm.StateDB.GetCode(addr)
 		if len(code) == 0 {
+			emptyCodeCallCounter.Inc(1)
+
 			ret, err = nil, nil // gas is unchanged
 		} else {
 			addrCopy := addr
@@ -279,6 +437,10 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 	if evm.depth > int(params.CallCreateDepth) {
 		return nil, gas, ErrDepth
 	}
+	// Fail sub-calls without executing them, see Config.NoSubCalls
+	if evm.Config.NoSubCalls && evm.depth > 0 {
+		return nil, gas, ErrSubCallsDisabled
+	}
 	// Fail if we're trying to transfer more than the available balance
 	// Note although it's noop to transfer X ether to caller itself. But
 	// if caller doesn't have enough balance, it would be an error to allow
@@ -297,6 +459,13 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 		}(gas)
 	}
 
+	if evm.hooksCallFrames() {
+		evm.enterCallFrame(CALLCODE, addr, input, value, gas)
+		defer func(startGas uint64) {
+			evm.exitCallFrame(CALLCODE, addr, startGas-gas, err)
+		}(gas)
+	}
+
 	// It is allowed to call precompiles, even via delegatecall
 	if p, isPrecompile := evm.precompile(addr); isPrecompile {
 		ret, gas, err = RunPrecompiledContract(p, input, gas)
@@ -331,6 +500,10 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 	if evm.depth > int(params.CallCreateDepth) {
 		return nil, gas, ErrDepth
 	}
+	// Fail sub-calls without executing them, see Config.NoSubCalls
+	if evm.Config.NoSubCalls && evm.depth > 0 {
+		return nil, gas, ErrSubCallsDisabled
+	}
 
 	var snapshot = evm.StateDB.Snapshot()
 
@@ -346,6 +519,13 @@ func (evm *EVM) DelegateCall(caller ContractRef, addr common.Address, input []by
 		}(gas)
 	}
 
+	if evm.hooksCallFrames() {
+		evm.enterCallFrame(DELEGATECALL, addr, input, caller.(*Contract).value, gas)
+		defer func(startGas uint64) {
+			evm.exitCallFrame(DELEGATECALL, addr, startGas-gas, err)
+		}(gas)
+	}
+
 	// It is allowed to call precompiles, even via delegatecall
 	if p, isPrecompile := evm.precompile(addr); isPrecompile {
 		ret, gas, err = RunPrecompiledContract(p, input, gas)
@@ -378,6 +558,10 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 	if evm.depth > int(params.CallCreateDepth) {
 		return nil, gas, ErrDepth
 	}
+	// Fail sub-calls without executing them, see Config.NoSubCalls
+	if evm.Config.NoSubCalls && evm.depth > 0 {
+		return nil, gas, ErrSubCallsDisabled
+	}
 	// We take a snapshot here. This is a bit counter-intuitive, and could probably be skipped.
 	// However, even a staticcall is considered a 'touch'. On mainnet, static calls were introduced
 	// after all empty accounts were deleted, so this is not required. However, if we omit this,
@@ -399,6 +583,13 @@ func (evm *EVM) StaticCall(caller ContractRef, addr common.Address, input []byte
 		}(gas)
 	}
 
+	if evm.hooksCallFrames() {
+		evm.enterCallFrame(STATICCALL, addr, input, nil, gas)
+		defer func(startGas uint64) {
+			evm.exitCallFrame(STATICCALL, addr, startGas-gas, err)
+		}(gas)
+	}
+
 	if p, isPrecompile := evm.precompile(addr); isPrecompile {
 		ret, gas, err = RunPrecompiledContract(p, input, gas)
 	} else {
@@ -492,6 +683,11 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 		}
 	}
 
+	hooksCallFrames := evm.hooksCallFrames()
+	if hooksCallFrames {
+		evm.enterCallFrame(typ, address, codeAndHash.code, value, gas)
+	}
+
 	ret, err := evm.interpreter.PreRun(contract, nil, false, nil)
 
 	// Check whether the max code size has been exceeded, assign err if the case.
@@ -536,6 +732,10 @@ func (evm *EVM) create(caller ContractRef, codeAndHash *codeAndHash, gas uint64,
 		}
 	}
 
+	if hooksCallFrames {
+		evm.exitCallFrame(typ, address, gas-contract.Gas, err)
+	}
+
 	return ret, address, contract.Gas, err
 }
 
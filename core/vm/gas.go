@@ -30,6 +30,20 @@ const (
 	GasExtStep     uint64 = 20
 )
 
+// CallGasBreakdown splits the dynamic gas of a CALL, CALLCODE, DELEGATECALL or STATICCALL into its
+// components, see Config.OnCallGasBreakdown. All but the Stipend add up to the dynamic gas charged.
+type CallGasBreakdown struct {
+	Memory        uint64 // Memory expansion for the arguments and the return data
+	ValueTransfer uint64 // Transfer of a non-zero value
+	NewAccount    uint64 // Creation of the callee by the value transfer
+	ColdAccess    uint64 // First access to the callee in the tx, on top of the warm access of the constant gas
+	Forwarded     uint64 // Gas passed to the callee after the 63/64 rule, unused gas is returned
+
+	// Stipend is passed to the callee on top of the forwarded gas when value is transferred,
+	// it isn't charged to the caller
+	Stipend uint64
+}
+
 // callGas returns the actual gas cost of the call.
 //
 // The cost of gas was changed during the homestead price change HF.
@@ -404,6 +404,7 @@ func gasExpEIP158(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memor
 func gasCall(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	var (
 		gas            uint64
+		breakdown      CallGasBreakdown
 		transfersValue = !stack.Back(2).IsZero()
 		address        = common.Address(stack.Back(1).Bytes20())
 	)
@@ -411,13 +412,17 @@ func gasCall(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize
 	if evm.chainRules.IsEIP158 {
 		if transfersValue && evm.StateDB.Empty(address) {
 			gas += params.CallNewAccountGas
+			breakdown.NewAccount = params.CallNewAccountGas
 		}
 	} else if !evm.StateDB.Exist(address) {
 		gas += params.CallNewAccountGas
+		breakdown.NewAccount = params.CallNewAccountGas
 	}
 
 	if transfersValue {
 		gas += params.CallValueTransferGas
+		breakdown.ValueTransfer = params.CallValueTransferGas
+		breakdown.Stipend = params.CallStipend
 	}
 
 	memoryGas, err := memoryGasCost(mem, memorySize)
@@ -439,6 +444,9 @@ func gasCall(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize
 		return 0, ErrGasUintOverflow
 	}
 
+	breakdown.Memory, breakdown.Forwarded = memoryGas, evm.callGasTemp
+	evm.callGasBreakdown = breakdown
+
 	return gas, nil
 }
 
@@ -449,12 +457,15 @@ func gasCallCode(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memory
 	}
 
 	var (
-		gas      uint64
-		overflow bool
+		gas       uint64
+		overflow  bool
+		breakdown = CallGasBreakdown{Memory: memoryGas}
 	)
 
 	if stack.Back(2).Sign() != 0 {
 		gas += params.CallValueTransferGas
+		breakdown.ValueTransfer = params.CallValueTransferGas
+		breakdown.Stipend = params.CallStipend
 	}
 
 	if gas, overflow = math.SafeAdd(gas, memoryGas); overflow {
@@ -470,6 +481,9 @@ func gasCallCode(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memory
 		return 0, ErrGasUintOverflow
 	}
 
+	breakdown.Forwarded = evm.callGasTemp
+	evm.callGasBreakdown = breakdown
+
 	return gas, nil
 }
 
@@ -484,11 +498,15 @@ func gasDelegateCall(evm *EVM, contract *Contract, stack *Stack, mem *Memory, me
 		return 0, err
 	}
 
+	memoryGas := gas
+
 	var overflow bool
 	if gas, overflow = math.SafeAdd(gas, evm.callGasTemp); overflow {
 		return 0, ErrGasUintOverflow
 	}
 
+	evm.callGasBreakdown = CallGasBreakdown{Memory: memoryGas, Forwarded: evm.callGasTemp}
+
 	return gas, nil
 }
 
@@ -503,11 +521,15 @@ func gasStaticCall(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memo
 		return 0, err
 	}
 
+	memoryGas := gas
+
 	var overflow bool
 	if gas, overflow = math.SafeAdd(gas, evm.callGasTemp); overflow {
 		return 0, ErrGasUintOverflow
 	}
 
+	evm.callGasBreakdown = CallGasBreakdown{Memory: memoryGas, Forwarded: evm.callGasTemp}
+
 	return gas, nil
 }
 
@@ -572,6 +572,13 @@ func opMstore8(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]
 func opSload(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
 	loc := scope.Stack.peek()
 	hash := common.Hash(loc.Bytes32())
+
+	if interpreter.evm.Config.WatchSlots != nil {
+		if err := interpreter.watchSlot(SLOAD, *pc, scope.Contract.Address(), hash); err != nil {
+			return nil, err
+		}
+	}
+
 	val := interpreter.evm.StateDB.GetState(scope.Contract.Address(), hash)
 	loc.SetBytes(val.Bytes())
 
@@ -585,7 +592,15 @@ func opSstore(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]b
 
 	loc := scope.Stack.pop()
 	val := scope.Stack.pop()
+
+	if interpreter.evm.Config.WatchSlots != nil {
+		if err := interpreter.watchSlot(SSTORE, *pc, scope.Contract.Address(), loc.Bytes32()); err != nil {
+			return nil, err
+		}
+	}
+
 	interpreter.evm.StateDB.SetState(scope.Contract.Address(), loc.Bytes32(), val.Bytes32())
+	interpreter.stateWrites = true
 
 	return nil, nil
 }
@@ -646,6 +661,8 @@ func opCreate(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]b
 		return nil, ErrWriteProtection
 	}
 
+	interpreter.stateWrites = true
+
 	var (
 		value        = scope.Stack.pop()
 		offset, size = scope.Stack.pop(), scope.Stack.pop()
@@ -667,6 +684,9 @@ func opCreate(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]b
 	}
 
 	res, addr, returnGas, suberr := interpreter.evm.Create(scope.Contract, input, gas, bigVal)
+	if err := interpreter.checkReturnData(res, suberr); err != nil {
+		return nil, err
+	}
 	// Push item on the stack based on the returned error. If the ruleset is
 	// homestead we must check for CodeStoreOutOfGasError (homestead only
 	// rule) and treat as an error, if the ruleset is frontier we must
@@ -697,6 +717,8 @@ func opCreate2(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]
 		return nil, ErrWriteProtection
 	}
 
+	interpreter.stateWrites = true
+
 	var (
 		endowment    = scope.Stack.pop()
 		offset, size = scope.Stack.pop(), scope.Stack.pop()
@@ -717,6 +739,9 @@ func opCreate2(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]
 
 	res, addr, returnGas, suberr := interpreter.evm.Create2(scope.Contract, input, gas,
 		bigEndowment, &salt)
+	if err := interpreter.checkReturnData(res, suberr); err != nil {
+		return nil, err
+	}
 	// Push item on the stack based on the returned error.
 	if suberr != nil {
 		stackvalue.Clear()
@@ -759,10 +784,18 @@ func opCall(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byt
 	// but it would make more sense to extend the usage of uint256.Int
 	if !value.IsZero() {
 		gas += params.CallStipend
-		bigVal = value.ToBig()
+
+		// the gas of the transfer is charged regardless, only the funds stay put
+		if !interpreter.evm.Config.DisableValueTransfer {
+			bigVal = value.ToBig()
+			interpreter.stateWrites = true
+		}
 	}
 
 	ret, returnGas, err := interpreter.evm.Call(scope.Contract, toAddr, args, gas, bigVal, nil)
+	if capErr := interpreter.checkReturnData(ret, err); capErr != nil {
+		return nil, capErr
+	}
 
 	if err != nil {
 		temp.Clear()
@@ -804,6 +837,10 @@ func opCallCode(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([
 	}
 
 	ret, returnGas, err := interpreter.evm.CallCode(scope.Contract, toAddr, args, gas, bigVal)
+	if capErr := interpreter.checkReturnData(ret, err); capErr != nil {
+		return nil, capErr
+	}
+
 	if err != nil {
 		temp.Clear()
 	} else {
@@ -836,6 +873,10 @@ func opDelegateCall(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext
 	args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
 
 	ret, returnGas, err := interpreter.evm.DelegateCall(scope.Contract, toAddr, args, gas)
+	if capErr := interpreter.checkReturnData(ret, err); capErr != nil {
+		return nil, capErr
+	}
+
 	if err != nil {
 		temp.Clear()
 	} else {
@@ -868,6 +909,10 @@ func opStaticCall(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext)
 	args := scope.Memory.GetPtr(int64(inOffset.Uint64()), int64(inSize.Uint64()))
 
 	ret, returnGas, err := interpreter.evm.StaticCall(scope.Contract, toAddr, args, gas)
+	if capErr := interpreter.checkReturnData(ret, err); capErr != nil {
+		return nil, capErr
+	}
+
 	if err != nil {
 		temp.Clear()
 	} else {
@@ -889,14 +934,15 @@ func opStaticCall(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext)
 
 func opReturn(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
 	offset, size := scope.Stack.pop(), scope.Stack.pop()
-	ret := scope.Memory.GetPtr(int64(offset.Uint64()), int64(size.Uint64()))
+	// the memory is reused once the run ends, the return data has to be copied
+	ret := scope.Memory.GetCopy(int64(offset.Uint64()), int64(size.Uint64()))
 
 	return ret, errStopToken
 }
 
 func opRevert(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
 	offset, size := scope.Stack.pop(), scope.Stack.pop()
-	ret := scope.Memory.GetPtr(int64(offset.Uint64()), int64(size.Uint64()))
+	ret := scope.Memory.GetCopy(int64(offset.Uint64()), int64(size.Uint64()))
 
 	interpreter.returnData = ret
 
@@ -916,6 +962,8 @@ func opSelfdestruct(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext
 		return nil, ErrWriteProtection
 	}
 
+	interpreter.stateWrites = true
+
 	beneficiary := scope.Stack.pop()
 	balance := interpreter.evm.StateDB.GetBalance(scope.Contract.Address())
 	interpreter.evm.StateDB.AddBalance(beneficiary.Bytes20(), balance)
@@ -924,6 +972,11 @@ func opSelfdestruct(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext
 		tracer.CaptureEnter(SELFDESTRUCT, scope.Contract.Address(), beneficiary.Bytes20(), []byte{}, 0, balance)
 		tracer.CaptureExit([]byte{}, 0, nil)
 	}
+
+	if sink := interpreter.selfDestructs; sink != nil {
+		sink.add(SelfDestruct{Address: scope.Contract.Address(), Beneficiary: beneficiary.Bytes20()})
+	}
+
 	return nil, errStopToken
 }
 
@@ -931,6 +984,9 @@ func opSelfdestruct6780(pc *uint64, interpreter *EVMInterpreter, scope *ScopeCon
 	if interpreter.readOnly {
 		return nil, ErrWriteProtection
 	}
+
+	interpreter.stateWrites = true
+
 	beneficiary := scope.Stack.pop()
 	balance := interpreter.evm.StateDB.GetBalance(scope.Contract.Address())
 	interpreter.evm.StateDB.SubBalance(scope.Contract.Address(), balance)
@@ -941,6 +997,10 @@ func opSelfdestruct6780(pc *uint64, interpreter *EVMInterpreter, scope *ScopeCon
 		tracer.CaptureExit([]byte{}, 0, nil)
 	}
 
+	if sink := interpreter.selfDestructs; sink != nil {
+		sink.add(SelfDestruct{Address: scope.Contract.Address(), Beneficiary: beneficiary.Bytes20()})
+	}
+
 	return nil, errStopToken
 }
 
@@ -962,6 +1022,11 @@ func makeLog(size int) executionFunc {
 			topics[i] = addr.Bytes32()
 		}
 
+		interpreter.logDataBytes += mSize.Uint64()
+		if max := interpreter.evm.Config.MaxLogDataBytes; max > 0 && interpreter.logDataBytes > max {
+			return nil, ErrLogDataTooLarge
+		}
+
 		d := scope.Memory.GetCopy(int64(mStart.Uint64()), int64(mSize.Uint64()))
 		interpreter.evm.StateDB.AddLog(&types.Log{
 			Address: scope.Contract.Address(),
@@ -19,6 +19,11 @@ package vm
 import (
 	"context"
 	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/ethereum/go-ethereum/common"
@@ -26,22 +31,56 @@ import (
 	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/ethereum/go-ethereum/log"
 	"github.com/ethereum/go-ethereum/metrics"
+	"github.com/ethereum/go-ethereum/params"
 
 	lru "github.com/hashicorp/golang-lru"
+	"github.com/holiman/uint256"
 )
 
 var (
 	opcodeCommitInterruptCounter = metrics.NewRegisteredCounter("worker/opcodeCommitInterrupt", nil)
+	emptyCodeCallCounter         = metrics.NewRegisteredCounter("vm/emptyCodeCall", nil) // calls skipped as the callee has no code
+	executionDurationHistogram   = metrics.NewRegisteredHistogram("vm/execution/duration", nil, metrics.NewExpDecaySample(1028, 0.015))
+	opcodeCounter                = metrics.NewRegisteredCounter("vm/opcodes", nil) // opcodes executed by top-level runs
+	interruptLatencyHistogram    = metrics.NewRegisteredHistogram("vm/interrupt/latency", nil, metrics.NewExpDecaySample(1028, 0.015))
 	ErrInterrupt                 = errors.New("EVM execution interrupted")
+	ErrInterruptEscalated        = fmt.Errorf("%w: tx ran past its interrupts too often", ErrInterrupt)
 	ErrNoCache                   = errors.New("no tx cache found")
 	ErrNoCurrentTx               = errors.New("no current tx found in interruptCtx")
+	ErrCancelled                 = fmt.Errorf("EVM execution cancelled: %w", context.Canceled)
 )
 
+// opcodeInterrupts mirrors opcodeCommitInterruptCounter, which doesn't count if metrics are disabled
+var opcodeInterrupts atomic.Int64
+
+// OpcodeInterruptCount returns the number of runs interrupted at the opcode level since the
+// process started, e.g. to adapt the block building deadlines to the interrupt rate.
+func OpcodeInterruptCount() int64 {
+	return opcodeInterrupts.Load()
+}
+
+// countOpcodeInterrupt counts a run interrupted through interruptCtx, along with the latency of the
+// interrupt, i.e. the time from the deadline closing the Done channel of the context to the abort.
+// A context cancelled before its deadline has no such latency.
+func countOpcodeInterrupt(interruptCtx context.Context) {
+	opcodeInterrupts.Add(1)
+	opcodeCommitInterruptCounter.Inc(1)
+
+	if deadline, ok := interruptCtx.Deadline(); ok && errors.Is(interruptCtx.Err(), context.DeadlineExceeded) {
+		interruptLatencyHistogram.Update(time.Since(deadline).Nanoseconds())
+	}
+}
+
 const (
 	// These are keys for the interruptCtx
 	InterruptCtxDelayKey       = "delay"
 	InterruptCtxOpcodeDelayKey = "opcodeDelay"
 
+	// InterruptCtxInterruptOnAddressKey carries a map[common.Address]struct{} of call
+	// targets, a call to any of them is interrupted once the interruptCtx is done, also
+	// from a nested call, which aborts the whole run
+	InterruptCtxInterruptOnAddressKey = "interruptOnAddress"
+
 	// InterruptedTxCacheSize is size of lru cache for interrupted txs
 	InterruptedTxCacheSize = 90000
 )
@@ -52,6 +91,113 @@ type Config struct {
 	NoBaseFee               bool      // Forces the EIP-1559 baseFee to 0 (needed for 0 price calls)
 	EnablePreimageRecording bool      // Enables recording of SHA3/keccak preimages
 	ExtraEips               []int     // Additional EIPS that are to be enabled
+
+	MaxOpcodesPerTx uint64 // Interrupts the execution after this many opcodes (0 = unlimited)
+
+	// TraceAddressFilter limits the opcodes passed to Tracer.CaptureState and CaptureFault to
+	// those executing the code of the given addresses, nil traces all of them
+	TraceAddressFilter map[common.Address]bool
+
+	// TraceNetCost passes the cost of an opcode net of its change to the refund counter to
+	// Tracer.CaptureState, e.g. an SSTORE clearing a slot is reported with its refund deducted
+	TraceNetCost bool
+
+	// OnRefund is called with the change of the refund counter whenever an opcode, i.e. SSTORE or
+	// SELFDESTRUCT, changes it. Refunds of reverted calls are dropped without a call.
+	OnRefund func(op OpCode, delta int64, pc uint64)
+
+	// OnCallGasBreakdown is called with the components of the dynamic gas of every CALL, CALLCODE,
+	// DELEGATECALL and STATICCALL once it's been charged
+	OnCallGasBreakdown func(op OpCode, pc uint64, breakdown CallGasBreakdown)
+
+	// InterruptRetries is the number of timeout interrupts a tx gets before it's allowed to run
+	// uninterrupted (0 = 1, negative = never interrupted)
+	InterruptRetries int
+
+	// InterruptEscalation is the number of times a tx is let through after using up its interrupts,
+	// its next timed out run fails with ErrInterruptEscalated to drop it from the block (0 = never)
+	InterruptEscalation int
+
+	// OnInterruptRetryScheduled is called with the hash of a tx when it's interrupted for the last time
+	// of its InterruptRetries, i.e. its next timed out run is let through to completion
+	OnInterruptRetryScheduled func(txHash common.Hash)
+
+	// PrecompileOverride replaces the execution of precompiles, gas is still charged as usual
+	PrecompileOverride map[common.Address]func(input []byte) ([]byte, error)
+
+	RecordStateDiff bool // Records the balances, nonces and storage slots changed by the tx, see EVM.StateDiff
+
+	// DisableRefunds doesn't apply the refund counter at the end of a tx, so its gas used is the raw
+	// consumption, e.g. for worst-case gas estimation
+	DisableRefunds bool
+
+	// PerCallGasOverhead is charged by every call and create opcode on top of its regular gas, e.g. to
+	// model the per-frame costs of a rollup (0 = none)
+	PerCallGasOverhead uint64
+
+	// DisableValueTransfer executes the CALL opcode as if its value was zero, while still charging the
+	// gas of a value transfer, e.g. to dry-run txs against a fork without moving funds
+	DisableValueTransfer bool
+
+	// NoSubCalls fails the CALL, CALLCODE, DELEGATECALL and STATICCALL opcodes with ErrSubCallsDisabled
+	// without executing the callee, so only the logic of the top-level frame runs. The caller sees
+	// a failed call and gets its gas back.
+	NoSubCalls bool
+
+	// MaxPooledStackSize leaves stacks which grew beyond this many items to the GC instead of returning
+	// them to the pool, bounding the memory held by the pool under parallel load (0 = no limit)
+	MaxPooledStackSize int
+
+	// VerifyMemoryZeroing panics when memory expansion exposes bytes which aren't zero, e.g. stale
+	// contents of a pooled memory which wasn't cleared. It's a debug guard with a cost on every expansion.
+	VerifyMemoryZeroing bool
+
+	// EnvSnapshot pins the block information read by the environment opcodes, e.g. to re-execute
+	// a tx for tracing, nil uses the block context of the EVM
+	EnvSnapshot *BlockEnv
+
+	// MaxReturnDataSize aborts the run with ErrReturnDataTooLarge once a call or create returns more
+	// bytes, zero means no limit
+	MaxReturnDataSize uint64
+
+	// MaxLogDataBytes aborts the run with ErrLogDataTooLarge once the data of the LOG events emitted by it,
+	// including those of nested calls, adds up to more bytes, zero means no limit
+	MaxLogDataBytes uint64
+
+	// WatchSlots are storage slots whose accesses by SLOAD and SSTORE are reported to OnWatchedSlot
+	// before the opcode is executed. Without OnWatchedSlot the access aborts the run with ErrWatchedSlot.
+	WatchSlots    map[StorageKey]bool
+	OnWatchedSlot func(key StorageKey, op OpCode, pc uint64) error // a non-nil error aborts the run with it
+
+	// OpcodePolicy flags opcodes, the ones executed are reported by FlaggedOpcodes
+	OpcodePolicy *OpcodePolicy
+
+	// GasAccountant transforms the gas charged per opcode, nil uses the standard accounting
+	GasAccountant GasAccountant
+
+	// OnCallEnter and OnCallExit are called when a call frame is entered and exited through one of
+	// the CALL or CREATE opcodes, the top-level call doesn't trigger them. The input is a copy of the
+	// calldata, or of the init code for the CREATE opcodes.
+	OnCallEnter func(typ OpCode, to common.Address, input []byte, value *big.Int, gas uint64)
+	OnCallExit  func(typ OpCode, to common.Address, gasUsed uint64, err error)
+
+	// OnStackPush is called with a copy of the value pushed by every executed opcode of
+	// StackPushOpcodes, e.g. to track the data flow for taint analysis. Opcodes which don't
+	// push a value are ignored.
+	OnStackPush      func(op OpCode, value *uint256.Int)
+	StackPushOpcodes []OpCode
+}
+
+// StorageKey identifies a storage slot of an account, see Config.WatchSlots
+type StorageKey struct {
+	Address common.Address
+	Slot    common.Hash
+}
+
+// GasAccountant allows for custom fee models by replacing the gas charged for an opcode. Charge gets the
+// constant and dynamic gas of the standard accounting and returns the gas to be deducted instead.
+type GasAccountant interface {
+	Charge(op OpCode, base, dynamic uint64) uint64
 }
 
 // ScopeContext contains the things that are per-call, such as stack and memory,
@@ -62,6 +208,16 @@ type ScopeContext struct {
 	Contract *Contract
 }
 
+// CodeAddress returns the address of the code being executed. Under DELEGATECALL and
+// CALLCODE it's the callee, whereas Contract.Address() is the caller whose state is used.
+func (s *ScopeContext) CodeAddress() common.Address {
+	if s.Contract.CodeAddr != nil {
+		return *s.Contract.CodeAddr
+	}
+
+	return s.Contract.Address()
+}
+
 // EVMInterpreter represents an EVM interpreter
 type EVMInterpreter struct {
 	evm   *EVM
@@ -70,8 +226,30 @@ type EVMInterpreter struct {
 	hasher    crypto.KeccakState // Keccak256 hasher instance shared across opcodes
 	hasherBuf common.Hash        // Keccak256 hasher result array shared across opcodes
 
-	readOnly   bool   // Whether to throw on stateful modifications
-	returnData []byte // Last CALL's return data for subsequent reuse
+	readOnly    bool   // Whether to throw on stateful modifications
+	wasReadOnly bool   // Whether the top-level call of the last run was readOnly
+	returnData  []byte // Last CALL's return data for subsequent reuse
+
+	opcodeCount   uint64 // Number of opcodes executed since the top-level call started
+	uninterrupted bool   // Whether the current top-level run used up its interrupts and mustn't be interrupted
+	finalRefund   uint64 // Refund counter at the end of the last top-level run
+
+	baseFeeReads uint64 // Number of BASEFEE opcodes executed in the last top-level run
+	logDataBytes uint64 // Data bytes of the LOG events emitted in the last top-level run
+	stateWrites  bool   // Whether an opcode of the last top-level run wrote to the state
+	ranOutOfGas  bool   // Whether the last top-level run failed with ErrOutOfGas
+	refundCapped uint64 // Refund withheld from the last tx by the refund cap, see ApplyRefundCap
+
+	executionDuration time.Duration // Wall-clock time of the last top-level run
+
+	flaggedOpcodes   []OpCode                    // Opcodes denied by Config.OpcodePolicy executed in the last top-level run
+	selfDestructs    *SelfDestructSink           // Sink of the interruptCtx of the current top-level run, nested calls don't get the context
+	callInterrupts   map[common.Address]struct{} // Call targets of the interruptCtx of the current top-level run, checked by nested calls too
+	callInterruptCtx context.Context             // interruptCtx of the current top-level run, see callInterrupts
+	stackPushOps     *[256]bool                  // Opcodes reported to Config.OnStackPush, nil if there's none
+	customTable      bool                        // Whether table is a copy extended by RegisterOpcode
+	registeredOps    [256]bool                   // Opcodes added to table by RegisterOpcode
+	tableName        string                      // Fork of the instruction set selected for the chain rules
 }
 
 // TxCache is a wrapper of lru.cache for caching transactions that get interrupted
@@ -79,6 +257,12 @@ type TxCache struct {
 	Cache *lru.Cache
 }
 
+// interruptRecord is the entry of a tx in the TxCache
+type interruptRecord struct {
+	interrupts int // timeout interrupts since the tx was last let through
+	allowances int // times the tx was let through after using up its interrupts
+}
+
 type txCacheKey struct{}
 type InterruptedTxContext_currenttxKey struct{}
 
@@ -102,6 +286,25 @@ func GetCurrentTxFromContext(ctx context.Context) (common.Hash, error) {
 	return c, nil
 }
 
+type metricsLabelKey struct{}
+
+// SetMetricsLabelOnContext sets a label on the context, the metrics of the runs interrupted through
+// it are additionally recorded under that label, e.g. to tell system txs from user txs
+func SetMetricsLabelOnContext(ctx context.Context, label string) context.Context {
+	return context.WithValue(ctx, metricsLabelKey{}, label)
+}
+
+// GetMetricsLabelFromContext gets the metrics label from the context, empty if there's none
+func GetMetricsLabelFromContext(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+
+	label, _ := ctx.Value(metricsLabelKey{}).(string)
+
+	return label
+}
+
 // GetCache returns the txCache from the context
 func GetCache(ctx context.Context) (*TxCache, error) {
 	val := ctx.Value(txCacheKey{})
@@ -122,36 +325,151 @@ func PutCache(ctx context.Context, cache *TxCache) context.Context {
 	return context.WithValue(ctx, txCacheKey{}, cache)
 }
 
+// RevertCounter counts the runs ending in ErrExecutionReverted, it is shared by all
+// the interpreters executing a block through the interruptCtx
+type RevertCounter struct {
+	count atomic.Int64
+}
+
+// Count returns the number of reverted runs seen so far
+func (c *RevertCounter) Count() int64 {
+	return c.count.Load()
+}
+
+type revertCounterKey struct{}
+
+// PutRevertCounter puts the revert counter into the context
+func PutRevertCounter(ctx context.Context, counter *RevertCounter) context.Context {
+	return context.WithValue(ctx, revertCounterKey{}, counter)
+}
+
+// GetRevertCounter returns the revert counter from the context, or nil if there is none
+func GetRevertCounter(ctx context.Context) *RevertCounter {
+	if ctx == nil {
+		return nil
+	}
+
+	c, _ := ctx.Value(revertCounterKey{}).(*RevertCounter)
+
+	return c
+}
+
+// SelfDestruct is a SELFDESTRUCT executed by a contract. It's reported when the
+// opcode is executed, even if the frame is reverted later on.
+type SelfDestruct struct {
+	Address     common.Address // the destructed contract
+	Beneficiary common.Address // the receiver of its balance
+}
+
+// SelfDestructSink collects the SELFDESTRUCTs executed in a block, it is shared by
+// all the interpreters executing the block through the interruptCtx
+type SelfDestructSink struct {
+	mu        sync.Mutex
+	destructs []SelfDestruct
+}
+
+func (s *SelfDestructSink) add(d SelfDestruct) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.destructs = append(s.destructs, d)
+}
+
+// SelfDestructs returns the SELFDESTRUCTs reported so far, in the order they were executed
+func (s *SelfDestructSink) SelfDestructs() []SelfDestruct {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return slices.Clone(s.destructs)
+}
+
+type selfDestructSinkKey struct{}
+
+// PutSelfDestructSink puts the self-destruct sink into the context
+func PutSelfDestructSink(ctx context.Context, sink *SelfDestructSink) context.Context {
+	return context.WithValue(ctx, selfDestructSinkKey{}, sink)
+}
+
+// GetSelfDestructSink returns the self-destruct sink from the context, or nil if there is none
+func GetSelfDestructSink(ctx context.Context) *SelfDestructSink {
+	if ctx == nil {
+		return nil
+	}
+
+	s, _ := ctx.Value(selfDestructSinkKey{}).(*SelfDestructSink)
+
+	return s
+}
+
+// getInterruptAddresses returns the set of call targets to interrupt on from the context
+func getInterruptAddresses(ctx context.Context) map[common.Address]struct{} {
+	if ctx == nil {
+		return nil
+	}
+
+	addrs, ok := ctx.Value(InterruptCtxInterruptOnAddressKey).(map[common.Address]struct{})
+	if !ok || len(addrs) == 0 {
+		return nil
+	}
+
+	return addrs
+}
+
+// setCallInterrupts takes the call targets to interrupt on from the interruptCtx of a top-level run.
+// Nested calls don't get the context, so they check their calls against the ones of the top-level run.
+func (in *EVMInterpreter) setCallInterrupts(interruptCtx context.Context) {
+	in.callInterruptCtx, in.callInterrupts = interruptCtx, getInterruptAddresses(interruptCtx)
+}
+
+// shouldInterruptCall reports whether op is a call to one of the flagged addresses
+// and the interruptCtx deadline has already passed.
+func shouldInterruptCall(op OpCode, stack *Stack, addrs map[common.Address]struct{}, interruptCtx context.Context) bool {
+	switch op {
+	case CALL, CALLCODE, DELEGATECALL, STATICCALL:
+	default:
+		return false
+	}
+
+	if _, ok := addrs[common.Address(stack.Back(1).Bytes20())]; !ok {
+		return false
+	}
+
+	return interruptCtx.Err() != nil
+}
+
 // NewEVMInterpreter returns a new instance of the Interpreter.
 func NewEVMInterpreter(evm *EVM) *EVMInterpreter {
 	// If jump table was not initialised we set the default one.
-	var table *JumpTable
+	var (
+		table     *JumpTable
+		tableName string
+	)
 
 	switch {
 	case evm.chainRules.IsCancun:
-		table = &cancunInstructionSet
+		table, tableName = &cancunInstructionSet, "cancun"
 	case evm.chainRules.IsShanghai:
-		table = &shanghaiInstructionSet
+		table, tableName = &shanghaiInstructionSet, "shanghai"
 	case evm.chainRules.IsMerge:
-		table = &mergeInstructionSet
+		table, tableName = &mergeInstructionSet, "merge"
 	case evm.chainRules.IsLondon:
-		table = &londonInstructionSet
+		table, tableName = &londonInstructionSet, "london"
 	case evm.chainRules.IsBerlin:
-		table = &berlinInstructionSet
+		table, tableName = &berlinInstructionSet, "berlin"
 	case evm.chainRules.IsIstanbul:
-		table = &istanbulInstructionSet
+		table, tableName = &istanbulInstructionSet, "istanbul"
 	case evm.chainRules.IsConstantinople:
-		table = &constantinopleInstructionSet
+		table, tableName = &constantinopleInstructionSet, "constantinople"
 	case evm.chainRules.IsByzantium:
-		table = &byzantiumInstructionSet
+		table, tableName = &byzantiumInstructionSet, "byzantium"
 	case evm.chainRules.IsEIP158:
-		table = &spuriousDragonInstructionSet
+		table, tableName = &spuriousDragonInstructionSet, "spuriousDragon"
 	case evm.chainRules.IsEIP150:
-		table = &tangerineWhistleInstructionSet
+		table, tableName = &tangerineWhistleInstructionSet, "tangerineWhistle"
 	case evm.chainRules.IsHomestead:
-		table = &homesteadInstructionSet
+		table, tableName = &homesteadInstructionSet, "homestead"
 	default:
-		table = &frontierInstructionSet
+		table, tableName = &frontierInstructionSet, "frontier"
 	}
 
 	var extraEips []int
@@ -172,207 +490,383 @@ func NewEVMInterpreter(evm *EVM) *EVMInterpreter {
 
 	evm.Config.ExtraEips = extraEips
 
-	return &EVMInterpreter{evm: evm, table: table}
+	in := &EVMInterpreter{evm: evm, table: table, tableName: tableName}
+
+	if evm.Config.OnStackPush != nil && len(evm.Config.StackPushOpcodes) > 0 {
+		in.stackPushOps = new([256]bool)
+		for _, op := range evm.Config.StackPushOpcodes {
+			// opcodes which don't push anything are never reported
+			if operation := table[op]; maxStack(operation.minStack, 0) > operation.maxStack {
+				in.stackPushOps[op] = true
+			}
+		}
+	}
+
+	return in
 }
 
-// PreRun is a wrapper around Run that allows for a delay to be injected before each opcode when induced by tests else it calls the lagace Run() method
-func (in *EVMInterpreter) PreRun(contract *Contract, input []byte, readOnly bool, interruptCtx context.Context) (ret []byte, err error) {
-	var opcodeDelay interface{}
+// TableName returns the fork whose instruction set the interpreter selected from the chain rules,
+// e.g. "cancun". ExtraEips and RegisterOpcode don't change it.
+func (in *EVMInterpreter) TableName() string {
+	return in.tableName
+}
 
-	if interruptCtx != nil {
-		if interruptCtx.Value(InterruptCtxOpcodeDelayKey) != nil {
-			opcodeDelay = interruptCtx.Value(InterruptCtxOpcodeDelayKey)
-		}
+// RegisterOpcode adds a custom opcode to the jump table of the interpreter, e.g. to prototype a new
+// opcode. The table is copied on the first registration, other interpreters are unaffected. Overriding
+// an opcode defined by the active fork is rejected on mainnet chains.
+func (in *EVMInterpreter) RegisterOpcode(op OpCode, fn executionFunc, constantGas uint64, minStack, maxStack int) error {
+	if !in.table[op].undefined && isMainnet(in.evm.chainConfig) {
+		return fmt.Errorf("%w: %v", ErrOpcodeOverride, op)
 	}
 
-	if opcodeDelay != nil {
-		return in.RunWithDelay(contract, input, readOnly, interruptCtx, opcodeDelay.(uint))
+	if !in.customTable {
+		in.table = copyJumpTable(in.table)
+		in.customTable = true
+	}
+
+	in.table[op] = &operation{
+		execute:     fn,
+		constantGas: constantGas,
+		minStack:    minStack,
+		maxStack:    maxStack,
 	}
+	in.registeredOps[op] = true
 
-	return in.Run(contract, input, readOnly, interruptCtx)
+	return nil
 }
 
-// Run loops and evaluates the contract's code with the given input data and returns
-// the return byte-slice and an error if one occurred.
-//
-// It's important to note that any errors returned by the interpreter should be
-// considered a revert-and-consume-all-gas operation except for
-// ErrExecutionReverted which means revert-and-keep-gas-left.
-// nolint: gocognit
-func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool, interruptCtx context.Context) (ret []byte, err error) {
-	// Increment the call depth which is restricted to 1024
-	in.evm.depth++
-	defer func() { in.evm.depth-- }()
+// SetStackValidator makes the interpreter check the stack with validate before executing op, instead of
+// the minimum and maximum stack length it was registered with, e.g. for an opcode whose stack requirements
+// depend on its arguments. The opcode must have been registered with RegisterOpcode. The validator has to
+// reject stacks the opcode can't execute on, its error aborts the run.
+func (in *EVMInterpreter) SetStackValidator(op OpCode, validate StackValidator) error {
+	if !in.registeredOps[op] {
+		return fmt.Errorf("opcode %v is not registered", op)
+	}
 
-	// Make sure the readOnly is only set if we aren't in readOnly yet.
-	// This also makes sure that the readOnly flag isn't removed for child calls.
-	if readOnly && !in.readOnly {
-		in.readOnly = true
-		defer func() { in.readOnly = false }()
+	in.table[op].validateStack = validate
+
+	return nil
+}
+
+// isMainnet reports whether config is the configuration of Ethereum or Polygon mainnet
+func isMainnet(config *params.ChainConfig) bool {
+	if config == nil || config.ChainID == nil {
+		return false
 	}
 
-	// Reset the previous call's return data. It's unimportant to preserve the old buffer
-	// as every returning call will return new data anyway.
-	in.returnData = nil
+	return config.ChainID.Cmp(params.MainnetChainConfig.ChainID) == 0 || config.ChainID.Cmp(params.BorMainnetChainConfig.ChainID) == 0
+}
 
-	// Don't bother with the execution if there's no code.
-	if len(contract.Code) == 0 {
-		return nil, nil
+// WasReadOnly returns whether the top-level call of the last run was executed
+// in readOnly mode (i.e. entered through STATICCALL).
+func (in *EVMInterpreter) WasReadOnly() bool {
+	return in.wasReadOnly
+}
+
+// FinalRefund returns the refund counter at the end of the last top-level run,
+// before any refund cap is applied by the state transition.
+func (in *EVMInterpreter) FinalRefund() uint64 {
+	return in.finalRefund
+}
+
+// FlaggedOpcodes returns the distinct opcodes denied by Config.OpcodePolicy which
+// were executed in the last top-level run, in the order of their first execution.
+func (in *EVMInterpreter) FlaggedOpcodes() []OpCode {
+	return in.flaggedOpcodes
+}
+
+// BaseFeeReads returns the number of BASEFEE opcodes executed in the last top-level run,
+// including those of nested calls.
+func (in *EVMInterpreter) BaseFeeReads() uint64 {
+	return in.baseFeeReads
+}
+
+// HadStateWrites returns true if the last top-level run, including nested calls, executed
+// an opcode writing to the state: SSTORE, CREATE, CREATE2, SELFDESTRUCT or a CALL with value.
+// Writes of reverted calls count as well, so a run without any can't conflict with other txs
+// through the state it changes. Transient storage and logs aren't state writes.
+func (in *EVMInterpreter) HadStateWrites() bool {
+	return in.stateWrites
+}
+
+// RanOutOfGas returns true if the last top-level run failed with ErrOutOfGas, e.g. a contract which
+// deliberately consumes all of its gas. An out of gas failure of a nested call which the top-level
+// frame recovered from doesn't count.
+func (in *EVMInterpreter) RanOutOfGas() bool {
+	return in.ranOutOfGas
+}
+
+// ApplyRefundCap caps the refund counter of a tx at the end of its execution to maxRefund, e.g. a fifth
+// of the gas used per EIP-3529, and records the withheld refund for RefundCapped.
+func (in *EVMInterpreter) ApplyRefundCap(counter, maxRefund uint64) uint64 {
+	if counter > maxRefund {
+		in.refundCapped = counter - maxRefund
+
+		return maxRefund
 	}
 
-	var (
-		op          OpCode        // current opcode
-		mem         = NewMemory() // bound memory
-		stack       = newstack()  // local stack
-		callContext = &ScopeContext{
-			Memory:   mem,
-			Stack:    stack,
-			Contract: contract,
+	in.refundCapped = 0
+
+	return counter
+}
+
+// RefundCapped returns whether the refund cap was hit by the last tx, and the refund it withheld
+func (in *EVMInterpreter) RefundCapped() (capped bool, amount uint64) {
+	return in.refundCapped > 0, in.refundCapped
+}
+
+// NoBaseFeeApplied returns true if Config.NoBaseFee lowered the base fee read by BASEFEE
+// to zero, so a run with BaseFeeReads may differ from its execution in a block.
+func (in *EVMInterpreter) NoBaseFeeApplied() bool {
+	return in.evm.noBaseFeeApplied
+}
+
+// ExecutionDuration returns the wall-clock time of the last top-level run, from entering
+// the interpreter until it returned, including nested calls.
+func (in *EVMInterpreter) ExecutionDuration() time.Duration {
+	return in.executionDuration
+}
+
+// startRunMetrics starts measuring a top-level run, the returned func records its duration and the
+// number of opcodes it executed, also under the metrics label of interruptCtx if it has one
+func (in *EVMInterpreter) startRunMetrics(interruptCtx context.Context) func() {
+	start, opcodes := time.Now(), in.opcodeCount
+
+	return func() {
+		in.executionDuration = time.Since(start)
+		executed := int64(in.opcodeCount - opcodes)
+
+		executionDurationHistogram.Update(int64(in.executionDuration))
+		opcodeCounter.Inc(executed)
+
+		if label := GetMetricsLabelFromContext(interruptCtx); label != "" {
+			metrics.GetOrRegisterHistogramLazy("vm/execution/duration/"+label, nil, func() metrics.Sample {
+				return metrics.NewExpDecaySample(1028, 0.015)
+			}).Update(int64(in.executionDuration))
+			metrics.GetOrRegisterCounter("vm/opcodes/"+label, nil).Inc(executed)
 		}
-		// For optimisation reason we're using uint64 as the program counter.
-		// It's theoretically possible to go above 2^64. The YP defines the PC
-		// to be uint256. Practically much less so feasible.
-		pc   = uint64(0) // program counter
-		cost uint64
-		// copies used by tracer
-		pcCopy  uint64 // needed for the deferred EVMLogger
-		gasCopy uint64 // for EVMLogger to log gas remaining before execution
-		logged  bool   // deferred EVMLogger should ignore already logged steps
-		res     []byte // result of the opcode execution function
-		debug   = in.evm.Config.Tracer != nil
-	)
-	// Don't move this deferred function, it's placed before the capturestate-deferred method,
-	// so that it gets executed _after_: the capturestate needs the stacks before
-	// they are returned to the pools
-	defer func() {
-		returnStack(stack)
-	}()
+	}
+}
 
-	contract.Input = input
+// callOverhead returns the Config.PerCallGasOverhead charged by op, if it enters a new frame
+func (in *EVMInterpreter) callOverhead(op OpCode) uint64 {
+	switch op {
+	case CALL, CALLCODE, DELEGATECALL, STATICCALL, CREATE, CREATE2:
+		return in.evm.Config.PerCallGasOverhead
+	}
 
-	if debug {
-		defer func() {
-			if err != nil {
-				if !logged {
-					in.evm.Config.Tracer.CaptureState(pcCopy, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
-				} else {
-					in.evm.Config.Tracer.CaptureFault(pcCopy, op, gasCopy, cost, callContext, in.evm.depth, err)
-				}
-			}
-		}()
+	return 0
+}
+
+// checkReturnData returns ErrReturnDataTooLarge if a call or create returned more than
+// Config.MaxReturnDataSize bytes. If a nested one aborted err because of this limit,
+// Config.MaxLogDataBytes, a watched slot or an interrupt, err is returned, so the whole
+// run is aborted.
+func (in *EVMInterpreter) checkReturnData(ret []byte, err error) error {
+	if err == ErrReturnDataTooLarge || err == ErrLogDataTooLarge || err == ErrInterrupt || errors.Is(err, ErrWatchedSlot) {
+		return err
 	}
-	// The Interpreter main run loop (contextual). This loop runs until either an
-	// explicit STOP, RETURN or SELFDESTRUCT is executed, an error occurred during
-	// the execution of one of the operations or until the done flag is set by the
-	// parent context.
-	for {
-		if interruptCtx != nil {
-			// case of interrupting by timeout
-			select {
-			case <-interruptCtx.Done():
-				txHash, _ := GetCurrentTxFromContext(interruptCtx)
-				interruptedTxCache, _ := GetCache(interruptCtx)
-
-				if interruptedTxCache == nil {
-					break
-				}
 
-				// if the tx is already in the cache, it means that it has been interrupted before and we will not interrupt it again
-				found, _ := interruptedTxCache.Cache.ContainsOrAdd(txHash, true)
-				if found {
-					interruptedTxCache.Cache.Remove(txHash)
-				} else {
-					// if the tx is not in the cache, it means that it has not been interrupted before and we will interrupt it
-					opcodeCommitInterruptCounter.Inc(1)
-					log.Warn("OPCODE Level interrupt")
+	if max := in.evm.Config.MaxReturnDataSize; max > 0 && uint64(len(ret)) > max {
+		return ErrReturnDataTooLarge
+	}
 
-					return nil, ErrInterrupt
-				}
-			default:
-			}
-		}
+	return nil
+}
 
-		if debug {
-			// Capture pre-execution values for tracing.
-			logged, pcCopy, gasCopy = false, pc, contract.Gas
-		}
-		// Get the operation from the jump table and validate the stack to ensure there are
-		// enough stack items available to perform the operation.
-		op = contract.GetOp(pc)
-		operation := in.table[op]
-		cost = operation.constantGas // For tracing
-		// Validate stack
-		if sLen := stack.len(); sLen < operation.minStack {
-			return nil, &ErrStackUnderflow{stackLen: sLen, required: operation.minStack}
-		} else if sLen > operation.maxStack {
-			return nil, &ErrStackOverflow{stackLen: sLen, limit: operation.maxStack}
-		}
+// checkInterrupt returns an error if the run has to be stopped because interruptCtx is done. A run
+// that timed out is only interrupted if its tx has been interrupted less than Config.InterruptRetries
+// times, unless it was let through Config.InterruptEscalation times already. The interrupts are
+// tracked in the TxCache of interruptCtx.
+func (in *EVMInterpreter) checkInterrupt(interruptCtx context.Context) error {
+	if interruptCtx == nil {
+		return nil
+	}
 
-		if !contract.UseGas(cost) {
-			return nil, ErrOutOfGas
-		}
-		// nolint : nestif
-		if operation.dynamicGas != nil {
-			// All ops with a dynamic memory usage also has a dynamic gas cost.
-			var memorySize uint64
-			// calculate the new memory size and expand the memory to fit
-			// the operation
-			// Memory check needs to be done prior to evaluating the dynamic gas portion,
-			// to detect calculation overflows
-			if operation.memorySize != nil {
-				memSize, overflow := operation.memorySize(stack)
-				if overflow {
-					return nil, ErrGasUintOverflow
-				}
-				// memory is expanded in words of 32 bytes. Gas
-				// is also calculated in words.
-				if memorySize, overflow = math.SafeMul(toWordSize(memSize), 32); overflow {
-					return nil, ErrGasUintOverflow
-				}
-			}
-			// Consume the gas and return an error if not enough gas is available.
-			// cost is explicitly set so that the capture state defer method can get the proper cost
-			var dynamicCost uint64
-			dynamicCost, err = operation.dynamicGas(in.evm, contract, stack, mem, memorySize)
-			cost += dynamicCost // for tracing
+	select {
+	case <-interruptCtx.Done():
+	default:
+		return nil
+	}
 
-			if err != nil || !contract.UseGas(dynamicCost) {
-				return nil, ErrOutOfGas
-			}
+	// case of cancelling explicitly, e.g. through a CancelFunc
+	if errors.Is(interruptCtx.Err(), context.Canceled) {
+		return ErrCancelled
+	}
 
-			if memorySize > 0 {
-				mem.Resize(memorySize)
-			}
+	// case of interrupting by timeout
+	if in.uninterrupted {
+		return nil
+	}
+
+	txHash, _ := GetCurrentTxFromContext(interruptCtx)
+	interruptedTxCache, _ := GetCache(interruptCtx)
+
+	if interruptedTxCache == nil {
+		return nil
+	}
+
+	retries := in.evm.Config.InterruptRetries
+	if retries == 0 {
+		retries = 1
+	}
+
+	var record interruptRecord
+	if val, ok := interruptedTxCache.Cache.Get(txHash); ok {
+		record, _ = val.(interruptRecord)
+	}
+
+	// if the tx has been let through too often already, it's dropped
+	if escalation := in.evm.Config.InterruptEscalation; escalation > 0 && record.allowances >= escalation {
+		countOpcodeInterrupt(interruptCtx)
+		log.Warn("OPCODE Level interrupt escalated", "tx", txHash)
+
+		return ErrInterruptEscalated
+	}
+
+	// if the tx has been interrupted often enough already, we let it run to completion
+	if retries < 0 || record.interrupts >= retries {
+		interruptedTxCache.Cache.Add(txHash, interruptRecord{allowances: record.allowances + 1})
+		in.uninterrupted = true
+
+		return nil
+	}
+
+	record.interrupts++
+	interruptedTxCache.Cache.Add(txHash, record)
+	countOpcodeInterrupt(interruptCtx)
+	log.Warn("OPCODE Level interrupt")
+
+	if onRetry := in.evm.Config.OnInterruptRetryScheduled; onRetry != nil && record.interrupts >= retries {
+		onRetry(txHash)
+	}
+
+	return ErrInterrupt
+}
+
+// netCost returns the cost of an opcode net of its change to the refund counter, see Config.TraceNetCost
+func netCost(cost, refundBefore, refundAfter uint64) uint64 {
+	if refundAfter < refundBefore {
+		return cost + (refundBefore - refundAfter)
+	}
+
+	if refund := refundAfter - refundBefore; refund < cost {
+		return cost - refund
+	}
+
+	return 0
+}
+
+// useDynamicGas deducts the dynamic gas of an opcode whose constant gas has already been deducted. With a
+// Config.GasAccountant the difference between its charge and the constant gas is settled instead.
+func (in *EVMInterpreter) useDynamicGas(contract *Contract, op OpCode, base, dynamic uint64) bool {
+	accountant := in.evm.Config.GasAccountant
+	if accountant == nil {
+		return contract.UseGas(dynamic)
+	}
+
+	charged := accountant.Charge(op, base, dynamic)
+	if charged < base {
+		contract.Gas += base - charged
+
+		return true
+	}
+
+	return contract.UseGas(charged - base)
+}
+
+// PreRun is a wrapper around Run that allows for a delay to be injected before each opcode when induced by tests else it calls the lagace Run() method
+func (in *EVMInterpreter) PreRun(contract *Contract, input []byte, readOnly bool, interruptCtx context.Context) (ret []byte, err error) {
+	var opcodeDelay interface{}
+
+	if interruptCtx != nil {
+		if interruptCtx.Value(InterruptCtxOpcodeDelayKey) != nil {
+			opcodeDelay = interruptCtx.Value(InterruptCtxOpcodeDelayKey)
 		}
+	}
 
-		if debug {
-			in.evm.Config.Tracer.CaptureState(pc, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
+	if in.evm.depth == 0 {
+		in.selfDestructs = GetSelfDestructSink(interruptCtx)
+	}
 
-			logged = true
+	if opcodeDelay != nil {
+		ret, err = in.RunWithDelay(contract, input, readOnly, interruptCtx, opcodeDelay.(uint))
+	} else {
+		ret, err = in.Run(contract, input, readOnly, interruptCtx)
+	}
+
+	if err == ErrExecutionReverted {
+		if counter := GetRevertCounter(interruptCtx); counter != nil {
+			counter.count.Add(1)
 		}
-		// execute the operation
-		res, err = operation.execute(&pc, in, callContext)
+	}
+
+	// Back at the top level, a failed run has all its refunds reverted
+	if in.evm.depth == 0 {
 		if err != nil {
-			break
+			in.finalRefund = 0
+		} else {
+			in.finalRefund = in.evm.StateDB.GetRefund()
 		}
-
-		pc++
 	}
 
-	if err == errStopToken {
-		err = nil // clear stop token error
-	}
+	return ret, err
+}
 
-	return res, err
+// RunWithGas runs the contract with its gas set to gasLimit and reports whether the
+// execution succeeded. All state changes are reverted afterwards, so it can be
+// called repeatedly with different limits, e.g. to binary search the gas needed.
+func (in *EVMInterpreter) RunWithGas(contract *Contract, input []byte, gasLimit uint64, readOnly bool, interruptCtx context.Context) (ret []byte, ok bool, err error) {
+	snapshot := in.evm.StateDB.Snapshot()
+	defer in.evm.StateDB.RevertToSnapshot(snapshot)
+
+	contract.Gas = gasLimit
+	ret, err = in.PreRun(contract, input, readOnly, interruptCtx)
+
+	return ret, err == nil, err
 }
 
+// resetRunStats resets the statistics collected by the previous top-level run
+func (in *EVMInterpreter) resetRunStats() {
+	in.opcodeCount = 0
+	in.uninterrupted = false
+	in.flaggedOpcodes = nil
+
+	in.baseFeeReads = 0
+	in.logDataBytes = 0
+	in.refundCapped = 0
+	in.stateWrites = false
+}
+
+// Run loops and evaluates the contract's code with the given input data and returns
+// the return byte-slice and an error if one occurred.
+//
+// It's important to note that any errors returned by the interpreter should be
+// considered a revert-and-consume-all-gas operation except for
+// ErrExecutionReverted which means revert-and-keep-gas-left.
+func (in *EVMInterpreter) Run(contract *Contract, input []byte, readOnly bool, interruptCtx context.Context) (ret []byte, err error) {
+	return in.run(contract, input, readOnly, interruptCtx, 0)
+}
+
+// run implements Run and RunWithDelay, sleeping for opcodeDelay before each opcode if it's set
 // nolint: gocognit
-// RunWithDelay is Run() with a delay between each opcode. Only used by testcases.
-func (in *EVMInterpreter) RunWithDelay(contract *Contract, input []byte, readOnly bool, interruptCtx context.Context, opcodeDelay uint) (ret []byte, err error) {
+func (in *EVMInterpreter) run(contract *Contract, input []byte, readOnly bool, interruptCtx context.Context, opcodeDelay time.Duration) (ret []byte, err error) {
 	// Increment the call depth which is restricted to 1024
 	in.evm.depth++
 	defer func() { in.evm.depth-- }()
 
+	// Remember the readOnly mode of the top-level call, it outlives the run
+	if in.evm.depth == 1 {
+		in.wasReadOnly = readOnly
+		in.resetRunStats()
+
+		defer in.startRunMetrics(interruptCtx)()
+		defer func() { in.ranOutOfGas = errors.Is(err, ErrOutOfGas) }()
+
+		in.setCallInterrupts(interruptCtx)
+	}
+
 	// Make sure the readOnly is only set if we aren't in readOnly yet.
 	// This also makes sure that the readOnly flag isn't removed for child calls.
 	if readOnly && !in.readOnly {
@@ -386,6 +880,8 @@ func (in *EVMInterpreter) RunWithDelay(contract *Contract, input []byte, readOnl
 
 	// Don't bother with the execution if there's no code.
 	if len(contract.Code) == 0 {
+		emptyCodeCallCounter.Inc(1)
+
 		return nil, nil
 	}
 
@@ -410,11 +906,19 @@ func (in *EVMInterpreter) RunWithDelay(contract *Contract, input []byte, readOnl
 		res     []byte // result of the opcode execution function
 		debug   = in.evm.Config.Tracer != nil
 	)
-	// Don't move this deferrred function, it's placed before the capturestate-deferred method,
-	// so that it gets executed _after_: the capturestate needs the stacks before
-	// they are returned to the pools
+
+	if filter := in.evm.Config.TraceAddressFilter; debug && filter != nil {
+		debug = filter[callContext.CodeAddress()]
+	}
+
+	mem.verifyZeroing = in.evm.Config.VerifyMemoryZeroing
+
+	// Don't move this deferred function, it's placed before the capturestate-deferred method,
+	// so that it gets executed _after_: the capturestate needs the stack and memory
+	// before they are returned to the pools
 	defer func() {
-		returnStack(stack)
+		returnStack(stack, in.evm.Config.MaxPooledStackSize)
+		mem.Free()
 	}()
 
 	contract.Input = input
@@ -435,35 +939,19 @@ func (in *EVMInterpreter) RunWithDelay(contract *Contract, input []byte, readOnl
 	// the execution of one of the operations or until the done flag is set by the
 	// parent context.
 	for {
-		if interruptCtx != nil {
-			// case of interrupting by timeout
-			select {
-			case <-interruptCtx.Done():
-				txHash, _ := GetCurrentTxFromContext(interruptCtx)
-				interruptedTxCache, _ := GetCache(interruptCtx)
-
-				if interruptedTxCache == nil {
-					break
-				}
-
-				// if the tx is already in the cache, it means that it has been interrupted before and we will not interrupt it again
-				found, _ := interruptedTxCache.Cache.ContainsOrAdd(txHash, true)
-				log.Info("FOUND", "found", found, "txHash", txHash)
-
-				if found {
-					interruptedTxCache.Cache.Remove(txHash)
-				} else {
-					// if the tx is not in the cache, it means that it has not been interrupted before and we will interrupt it
-					opcodeCommitInterruptCounter.Inc(1)
-					log.Warn("OPCODE Level interrupt")
+		if err := in.checkInterrupt(interruptCtx); err != nil {
+			return nil, err
+		}
 
-					return nil, ErrInterrupt
-				}
-			default:
-			}
+		if opcodeDelay > 0 {
+			time.Sleep(opcodeDelay)
 		}
 
-		time.Sleep(time.Duration(opcodeDelay) * time.Millisecond)
+		// case of interrupting by opcode count, this is deterministic across hardware
+		in.opcodeCount++
+		if maxOpcodes := in.evm.Config.MaxOpcodesPerTx; maxOpcodes != 0 && in.opcodeCount > maxOpcodes {
+			return nil, ErrInterrupt
+		}
 
 		if debug {
 			// Capture pre-execution values for tracing.
@@ -474,17 +962,42 @@ func (in *EVMInterpreter) RunWithDelay(contract *Contract, input []byte, readOnl
 		op = contract.GetOp(pc)
 		operation := in.table[op]
 		cost = operation.constantGas // For tracing
+
+		if policy := in.evm.Config.OpcodePolicy; policy != nil && policy.Denied(op) && !slices.Contains(in.flaggedOpcodes, op) {
+			in.flaggedOpcodes = append(in.flaggedOpcodes, op)
+		}
+
 		// Validate stack
-		if sLen := stack.len(); sLen < operation.minStack {
+		if validate := operation.validateStack; validate != nil {
+			if err := validate(stack); err != nil {
+				return nil, err
+			}
+		} else if sLen := stack.len(); sLen < operation.minStack {
 			return nil, &ErrStackUnderflow{stackLen: sLen, required: operation.minStack}
 		} else if sLen > operation.maxStack {
 			return nil, &ErrStackOverflow{stackLen: sLen, limit: operation.maxStack}
 		}
 
+		if in.callInterrupts != nil && shouldInterruptCall(op, stack, in.callInterrupts, in.callInterruptCtx) {
+			countOpcodeInterrupt(in.callInterruptCtx)
+			log.Warn("OPCODE Level interrupt on call target")
+
+			return nil, ErrInterrupt
+		}
+
 		if !contract.UseGas(cost) {
 			return nil, ErrOutOfGas
 		}
 
+		// charged before the dynamic gas, so the gas passed on to the new frame accounts for it
+		if overhead := in.callOverhead(op); overhead > 0 {
+			if !contract.UseGas(overhead) {
+				return nil, ErrOutOfGas
+			}
+
+			cost += overhead // for tracing
+		}
+		// nolint : nestif
 		if operation.dynamicGas != nil {
 			// All ops with a dynamic memory usage also has a dynamic gas cost.
 			var memorySize uint64
@@ -505,24 +1018,46 @@ func (in *EVMInterpreter) RunWithDelay(contract *Contract, input []byte, readOnl
 			}
 			// Consume the gas and return an error if not enough gas is available.
 			// cost is explicitly set so that the capture state defer method can get the proper cost
-			var dynamicCost uint64
+			var dynamicCost, refund uint64
+
+			onRefund := in.evm.Config.OnRefund
+			if (debug && in.evm.Config.TraceNetCost) || onRefund != nil {
+				refund = in.evm.StateDB.GetRefund()
+			}
+
 			dynamicCost, err = operation.dynamicGas(in.evm, contract, stack, mem, memorySize)
 			cost += dynamicCost // for tracing
 
-			if err != nil || !contract.UseGas(dynamicCost) {
+			if debug && in.evm.Config.TraceNetCost {
+				cost = netCost(cost, refund, in.evm.StateDB.GetRefund())
+			}
+
+			if onRefund != nil {
+				// the difference wraps around for a decrease, which converts to the negative delta
+				if after := in.evm.StateDB.GetRefund(); after != refund {
+					onRefund(op, int64(after-refund), pc)
+				}
+			}
+
+			if err != nil || !in.useDynamicGas(contract, op, operation.constantGas, dynamicCost) {
 				return nil, ErrOutOfGas
 			}
-			// Do tracing before memory expansion
-			if debug {
-				in.evm.Config.Tracer.CaptureState(pc, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
 
-				logged = true
+			if onCallGas := in.evm.Config.OnCallGasBreakdown; onCallGas != nil {
+				switch op {
+				case CALL, CALLCODE, DELEGATECALL, STATICCALL:
+					onCallGas(op, pc, in.evm.callGasBreakdown)
+				}
 			}
 
 			if memorySize > 0 {
 				mem.Resize(memorySize)
 			}
-		} else if debug {
+		} else if in.evm.Config.GasAccountant != nil && !in.useDynamicGas(contract, op, operation.constantGas, 0) {
+			return nil, ErrOutOfGas
+		}
+
+		if debug {
 			in.evm.Config.Tracer.CaptureState(pc, op, gasCopy, cost, callContext, in.returnData, in.evm.depth, err)
 
 			logged = true
@@ -533,6 +1068,10 @@ func (in *EVMInterpreter) RunWithDelay(contract *Contract, input []byte, readOnl
 			break
 		}
 
+		if in.stackPushOps != nil && in.stackPushOps[op] {
+			in.evm.Config.OnStackPush(op, new(uint256.Int).Set(stack.peek()))
+		}
+
 		pc++
 	}
 
@@ -542,3 +1081,22 @@ func (in *EVMInterpreter) RunWithDelay(contract *Contract, input []byte, readOnl
 
 	return res, err
 }
+
+// watchSlot reports an access of op to the slot of addr if it's one of Config.WatchSlots
+func (in *EVMInterpreter) watchSlot(op OpCode, pc uint64, addr common.Address, slot common.Hash) error {
+	key := StorageKey{Address: addr, Slot: slot}
+	if !in.evm.Config.WatchSlots[key] {
+		return nil
+	}
+
+	if onWatchedSlot := in.evm.Config.OnWatchedSlot; onWatchedSlot != nil {
+		return onWatchedSlot(key, op, pc)
+	}
+
+	return fmt.Errorf("%w: %v at pc %d, slot %x of %x", ErrWatchedSlot, op, pc, slot, addr)
+}
+
+// RunWithDelay is Run() with a delay between each opcode. Only used by testcases.
+func (in *EVMInterpreter) RunWithDelay(contract *Contract, input []byte, readOnly bool, interruptCtx context.Context, opcodeDelay uint) (ret []byte, err error) {
+	return in.run(contract, input, readOnly, interruptCtx, time.Duration(opcodeDelay)*time.Millisecond)
+}
@@ -17,7 +17,13 @@
 package vm
 
 import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
 	"math/big"
+	"reflect"
+	"slices"
 	"testing"
 	"time"
 
@@ -26,7 +32,11 @@ import (
 	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
 	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/metrics"
 	"github.com/ethereum/go-ethereum/params"
+
+	lru "github.com/hashicorp/golang-lru"
+	"github.com/holiman/uint256"
 )
 
 var loopInterruptTests = []string{
@@ -75,3 +85,1890 @@ func TestLoopInterrupt(t *testing.T) {
 		}
 	}
 }
+
+// testBlockContext returns a block context at genesis which never fails transfers
+func testBlockContext() BlockContext {
+	return BlockContext{
+		CanTransfer: func(StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+}
+
+// newTestState returns an in-memory state with the given contracts deployed
+func newTestState(contracts map[common.Address][]byte) *state.StateDB {
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	for addr, code := range contracts {
+		statedb.SetCode(addr, code)
+	}
+
+	statedb.Finalise(true)
+
+	return statedb
+}
+
+func TestInterruptOnCallTarget(t *testing.T) {
+	var (
+		caller  = common.BytesToAddress([]byte("caller"))
+		relay   = common.BytesToAddress([]byte("relay"))
+		flagged = common.BytesToAddress([]byte("flagged"))
+		other   = common.BytesToAddress([]byte("other"))
+	)
+
+	// callCode returns bytecode calling target with no args, value or return data
+	callCode := func(target common.Address) []byte {
+		code := []byte{
+			byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, // retSize, retOffset, argsSize, argsOffset
+			byte(PUSH1), 0, // value
+			byte(PUSH20),
+		}
+		code = append(code, target.Bytes()...)
+		code = append(code, byte(GAS), byte(CALL), byte(STOP))
+
+		return code
+	}
+
+	interruptCtx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+
+	interruptCtx = context.WithValue(interruptCtx, InterruptCtxInterruptOnAddressKey, map[common.Address]struct{}{flagged: {}})
+
+	for _, tt := range []struct {
+		target common.Address
+		err    error
+	}{
+		{flagged, ErrInterrupt},
+		{other, nil},
+		// the flagged address is called by a nested call
+		{relay, ErrInterrupt},
+	} {
+		statedb := newTestState(map[common.Address][]byte{
+			caller:  callCode(tt.target),
+			relay:   callCode(flagged),
+			flagged: {byte(STOP)},
+			other:   {byte(STOP)},
+		})
+
+		evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+
+		_, _, err := evm.Call(AccountRef(common.Address{}), caller, nil, 100000, new(big.Int), interruptCtx)
+		if err != tt.err {
+			t.Errorf("call to %x: have error %v, want %v", tt.target, err, tt.err)
+		}
+	}
+}
+
+func TestOpcodeInterruptCount(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{address: {byte(STOP)}})
+
+	interruptCtx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+
+	interruptCtx = context.WithValue(interruptCtx, InterruptCtxInterruptOnAddressKey, map[common.Address]struct{}{address: {}})
+
+	// call(gas, address, 0, 0, 0, 0, 0), interrupted as address is flagged
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, address.Bytes()...)
+	code = append(code, byte(GAS), byte(CALL), byte(STOP))
+
+	caller := common.BytesToAddress([]byte("caller"))
+	statedb.SetCode(caller, code)
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+
+	before := OpcodeInterruptCount()
+
+	for i := int64(1); i <= 3; i++ {
+		if _, _, err := evm.Call(AccountRef(common.Address{}), caller, nil, 100000, new(big.Int), interruptCtx); err != ErrInterrupt {
+			t.Fatalf("call %d: have error %v, want %v", i, err, ErrInterrupt)
+		}
+
+		if have := OpcodeInterruptCount() - before; have != i {
+			t.Errorf("interrupt count mismatch after %d calls: have %d", i, have)
+		}
+	}
+}
+
+func TestWasReadOnly(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+
+	statedb := newTestState(map[common.Address][]byte{address: {byte(STOP)}})
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+
+	if _, _, err := evm.StaticCall(AccountRef(common.Address{}), address, nil, 100000); err != nil {
+		t.Fatalf("static call failed: %v", err)
+	}
+
+	if !evm.Interpreter().WasReadOnly() {
+		t.Error("static entry not reported as readOnly")
+	}
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	if evm.Interpreter().WasReadOnly() {
+		t.Error("non-static entry reported as readOnly")
+	}
+}
+
+func TestRevertCounter(t *testing.T) {
+	var (
+		reverter = common.BytesToAddress([]byte("reverter"))
+		stopper  = common.BytesToAddress([]byte("stopper"))
+		caller   = common.BytesToAddress([]byte("caller"))
+	)
+
+	// call(gas, reverter, 0, 0, 0, 0, 0), ignoring the result
+	callCode := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	callCode = append(callCode, reverter.Bytes()...)
+	callCode = append(callCode, byte(GAS), byte(CALL), byte(POP), byte(STOP))
+
+	statedb := newTestState(map[common.Address][]byte{
+		reverter: {byte(PUSH1), 0, byte(PUSH1), 0, byte(REVERT)},
+		stopper:  {byte(STOP)},
+		caller:   callCode,
+	})
+
+	for _, tt := range []struct {
+		name  string
+		calls []common.Address
+		want  int64
+	}{
+		{"mixed", []common.Address{reverter, stopper, reverter, stopper, stopper}, 2},
+		{"no reverts", []common.Address{stopper, stopper}, 0},
+		{"all reverted", []common.Address{reverter, reverter, reverter}, 3},
+		// only the top-level run counts, the caller doesn't revert
+		{"nested revert", []common.Address{caller}, 0},
+	} {
+		counter := new(RevertCounter)
+		interruptCtx := PutRevertCounter(context.Background(), counter)
+
+		for _, addr := range tt.calls {
+			evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+			_, _, _ = evm.Call(AccountRef(common.Address{}), addr, nil, 100000, new(big.Int), interruptCtx)
+		}
+
+		if have := counter.Count(); have != tt.want {
+			t.Errorf("%s: revert count mismatch: have %d, want %d", tt.name, have, tt.want)
+		}
+	}
+}
+
+func TestMaxOpcodesPerTx(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	// five JUMPDESTs followed by STOP, six opcodes in total
+	statedb := newTestState(map[common.Address][]byte{
+		address: {byte(JUMPDEST), byte(JUMPDEST), byte(JUMPDEST), byte(JUMPDEST), byte(JUMPDEST), byte(STOP)},
+	})
+
+	for _, tt := range []struct {
+		max uint64
+		err error
+	}{
+		{0, nil},
+		{5, ErrInterrupt},
+		{6, nil},
+	} {
+		evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{MaxOpcodesPerTx: tt.max})
+
+		_, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil)
+		if err != tt.err {
+			t.Errorf("max %d: have error %v, want %v", tt.max, err, tt.err)
+		}
+	}
+}
+
+func TestFinalRefund(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	// clear slots 0 and 1
+	statedb := newTestState(map[common.Address][]byte{
+		address: {byte(PUSH1), 0, byte(PUSH1), 0, byte(SSTORE), byte(PUSH1), 0, byte(PUSH1), 1, byte(SSTORE), byte(STOP)},
+	})
+	statedb.SetState(address, common.Hash{}, common.Hash{1})
+	statedb.SetState(address, common.Hash{31: 1}, common.Hash{1})
+	statedb.Finalise(true)
+	statedb.AddAddressToAccessList(address)
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	if have, want := evm.Interpreter().FinalRefund(), 2*params.SstoreClearsScheduleRefundEIP3529; have != want {
+		t.Errorf("final refund mismatch: have %d, want %d", have, want)
+	}
+}
+
+func TestRunWithGas(t *testing.T) {
+	var (
+		address = common.BytesToAddress([]byte("contract"))
+		code    = []byte{byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE), byte(STOP)}
+		statedb = newTestState(map[common.Address][]byte{address: code})
+	)
+
+	statedb.AddAddressToAccessList(address)
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+
+	contract := NewContract(AccountRef(common.Address{}), AccountRef(address), new(big.Int), 0)
+	contract.SetCallCode(&address, statedb.GetCodeHash(address), code)
+
+	// binary search the lowest gas limit the contract succeeds with
+	lo, hi := uint64(0), uint64(100000)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if _, ok, _ := evm.Interpreter().RunWithGas(contract, nil, mid, false, nil); ok {
+			hi = mid
+		} else {
+			lo = mid + 1
+		}
+	}
+
+	// two pushes and an SSTORE setting a cold, empty slot
+	if want := 2*GasFastestStep + params.SstoreSetGasEIP2200 + params.ColdSloadCostEIP2929; lo != want {
+		t.Errorf("minimum gas mismatch: have %d, want %d", lo, want)
+	}
+
+	if statedb.GetState(address, common.Hash{}) != (common.Hash{}) {
+		t.Error("state changes of RunWithGas were not reverted")
+	}
+}
+
+// runStats collects the statistics and hook calls of a run, see TestRunWithDelay
+type runStats struct {
+	Refunds    []int64
+	CallGas    []CallGasBreakdown
+	SstoreCost uint64
+}
+
+func TestRunWithDelay(t *testing.T) {
+	var (
+		address   = common.BytesToAddress([]byte("contract"))
+		recipient = common.BytesToAddress([]byte("recipient"))
+	)
+
+	// sstore(0, 0) clearing a slot set before, then a call of the empty recipient
+	code := []byte{
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(SSTORE),
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0,
+		byte(PUSH20),
+	}
+	code = append(code, recipient.Bytes()...)
+	code = append(code, byte(PUSH2), 0x10, 0x00, byte(CALL), byte(STOP))
+
+	statedb := newTestState(map[common.Address][]byte{address: code})
+	statedb.SetState(address, common.Hash{}, common.BigToHash(big.NewInt(1)))
+	statedb.IntermediateRoot(true)
+	statedb.AddAddressToAccessList(address)
+
+	run := func(interruptCtx context.Context) runStats {
+		var stats runStats
+
+		tracer := &costTracer{costs: make(map[OpCode]uint64)}
+		evm := NewEVM(testBlockContext(), TxContext{GasPrice: new(big.Int)}, statedb, params.AllEthashProtocolChanges, Config{
+			Tracer:       tracer,
+			TraceNetCost: true,
+			OnRefund: func(op OpCode, delta int64, pc uint64) {
+				stats.Refunds = append(stats.Refunds, delta)
+			},
+			OnCallGasBreakdown: func(op OpCode, pc uint64, breakdown CallGasBreakdown) {
+				stats.CallGas = append(stats.CallGas, breakdown)
+			},
+		})
+
+		// the second run must not accumulate the statistics of the first one
+		for i := 0; i < 2; i++ {
+			stats.Refunds, stats.CallGas = nil, nil
+			snapshot := statedb.Snapshot()
+
+			if _, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), interruptCtx); err != nil {
+				t.Fatalf("call failed: %v", err)
+			}
+
+			statedb.RevertToSnapshot(snapshot)
+		}
+
+		stats.SstoreCost = tracer.costs[SSTORE]
+
+		return stats
+	}
+
+	want := run(context.Background())
+	if len(want.Refunds) != 1 || len(want.CallGas) != 1 {
+		t.Fatalf("unexpected statistics of the run: %+v", want)
+	}
+
+	delayed := context.WithValue(context.Background(), InterruptCtxOpcodeDelayKey, uint(1))
+	if have := run(delayed); !reflect.DeepEqual(have, want) {
+		t.Errorf("run with delay mismatch:\nhave %+v\nwant %+v", have, want)
+	}
+}
+
+func TestCallFrameHooks(t *testing.T) {
+	var (
+		outer  = common.BytesToAddress([]byte("outer"))
+		middle = common.BytesToAddress([]byte("middle"))
+		inner  = common.BytesToAddress([]byte("inner"))
+	)
+
+	// callCode returns bytecode calling target with gas<<8 and no args or return data
+	callCode := func(op OpCode, target common.Address, gas byte) []byte {
+		code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0} // retSize, retOffset, argsSize, argsOffset
+		if op == CALL {
+			code = append(code, byte(PUSH1), 7) // value
+		}
+
+		code = append(code, byte(PUSH20))
+		code = append(code, target.Bytes()...)
+		code = append(code, byte(PUSH2), gas, 0, byte(op), byte(STOP))
+
+		return code
+	}
+
+	statedb := newTestState(map[common.Address][]byte{
+		outer:  callCode(CALL, middle, 0x10),
+		middle: callCode(STATICCALL, inner, 0x01),
+		inner:  {byte(STOP)},
+	})
+	statedb.AddBalance(outer, big.NewInt(7))
+
+	var frames []string
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{
+		OnCallEnter: func(typ OpCode, to common.Address, input []byte, value *big.Int, gas uint64) {
+			frames = append(frames, fmt.Sprintf("enter %v %x %v %d", typ, to, value, gas))
+		},
+		OnCallExit: func(typ OpCode, to common.Address, gasUsed uint64, err error) {
+			frames = append(frames, fmt.Sprintf("exit %v %x %v", typ, to, err))
+		},
+	})
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), outer, nil, 1000000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	want := []string{
+		fmt.Sprintf("enter CALL %x 7 %d", middle, 0x1000+params.CallStipend),
+		fmt.Sprintf("enter STATICCALL %x <nil> %d", inner, 0x100),
+		fmt.Sprintf("exit STATICCALL %x <nil>", inner),
+		fmt.Sprintf("exit CALL %x <nil>", middle),
+	}
+	if !slices.Equal(frames, want) {
+		t.Errorf("call frames mismatch:\nhave %q\nwant %q", frames, want)
+	}
+}
+
+func TestCallFrameInput(t *testing.T) {
+	var (
+		outer  = common.BytesToAddress([]byte("outer"))
+		middle = common.BytesToAddress([]byte("middle"))
+		inner  = common.BytesToAddress([]byte("inner"))
+
+		outerArgs  = bytes.Repeat([]byte{0x11}, 32)
+		middleArgs = bytes.Repeat([]byte{0x22}, 32)
+	)
+
+	// callCode returns bytecode storing word at offset 0 and passing its first argsSize bytes to target,
+	// the word is overwritten once the call returns
+	callCode := func(op OpCode, target common.Address, word []byte, argsSize byte) []byte {
+		code := append([]byte{byte(PUSH32)}, word...)
+		code = append(code, byte(PUSH1), 0, byte(MSTORE))
+		code = append(code, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), argsSize, byte(PUSH1), 0) // retSize, retOffset, argsSize, argsOffset
+
+		if op == CALL {
+			code = append(code, byte(PUSH1), 0) // value
+		}
+
+		code = append(code, byte(PUSH20))
+		code = append(code, target.Bytes()...)
+		code = append(code, byte(GAS), byte(op), byte(POP))
+		code = append(code, byte(PUSH1), 0xff, byte(PUSH1), 0, byte(MSTORE), byte(STOP))
+
+		return code
+	}
+
+	statedb := newTestState(map[common.Address][]byte{
+		outer:  callCode(CALL, middle, outerArgs, 32),
+		middle: callCode(STATICCALL, inner, middleArgs, 4),
+		inner:  {byte(STOP)},
+	})
+
+	var inputs [][]byte
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{
+		OnCallEnter: func(typ OpCode, to common.Address, input []byte, value *big.Int, gas uint64) {
+			inputs = append(inputs, input)
+		},
+	})
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), outer, nil, 1000000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	// the memory the inputs were read from has been overwritten and reused since
+	want := [][]byte{outerArgs, middleArgs[:4]}
+	if !slices.EqualFunc(inputs, want, bytes.Equal) {
+		t.Errorf("call frame inputs mismatch:\nhave %x\nwant %x", inputs, want)
+	}
+}
+
+func TestCallProfilerFolded(t *testing.T) {
+	var (
+		outer  = common.BytesToAddress([]byte("outer"))
+		middle = common.BytesToAddress([]byte("middle"))
+		inner  = common.BytesToAddress([]byte("inner"))
+	)
+
+	// callCode returns bytecode calling target twice with no args or return data
+	callCode := func(target common.Address) []byte {
+		var code []byte
+		for i := 0; i < 2; i++ {
+			code = append(code, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20))
+			code = append(code, target.Bytes()...)
+			code = append(code, byte(GAS), byte(STATICCALL), byte(POP))
+		}
+
+		return append(code, byte(STOP))
+	}
+
+	statedb := newTestState(map[common.Address][]byte{
+		outer:  callCode(middle),
+		middle: callCode(inner),
+		inner:  {byte(STOP)},
+	})
+
+	// every reading of the clock advances it by a nanosecond
+	var clock time.Time
+
+	profiler := NewCallProfiler()
+	profiler.now = func() time.Time {
+		clock = clock.Add(time.Nanosecond)
+		return clock
+	}
+
+	var cfg Config
+	profiler.Hook(&cfg)
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, cfg)
+
+	profiler.Enter(outer)
+	if _, _, err := evm.Call(AccountRef(common.Address{}), outer, nil, 1000000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+	profiler.Exit()
+
+	var out bytes.Buffer
+	if err := profiler.WriteFolded(&out); err != nil {
+		t.Fatalf("failed to write profile: %v", err)
+	}
+
+	// outer spans 13ns, each middle 5ns, each inner 1ns
+	want := fmt.Sprintf("%s 3\n%s;%s 6\n%s;%s;%s 4\n",
+		outer.Hex(),
+		outer.Hex(), middle.Hex(),
+		outer.Hex(), middle.Hex(), inner.Hex())
+	if out.String() != want {
+		t.Errorf("folded profile mismatch:\nhave %q\nwant %q", out.String(), want)
+	}
+}
+
+func TestStackPoolMetrics(t *testing.T) {
+	defer func(gets, misses, puts, drops metrics.Counter) {
+		stackPoolGetCounter, stackPoolMissCounter, stackPoolPutCounter, stackPoolDropCounter = gets, misses, puts, drops
+	}(stackPoolGetCounter, stackPoolMissCounter, stackPoolPutCounter, stackPoolDropCounter)
+
+	stackPoolGetCounter, stackPoolMissCounter = metrics.NewCounterForced(), metrics.NewCounterForced()
+	stackPoolPutCounter, stackPoolDropCounter = metrics.NewCounterForced(), metrics.NewCounterForced()
+
+	var (
+		shallow = common.BytesToAddress([]byte("shallow"))
+		deep    = common.BytesToAddress([]byte("deep"))
+		caller  = common.BytesToAddress([]byte("caller"))
+	)
+
+	// staticcall(gas, shallow, 0, 0, 0, 0)
+	callCode := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	callCode = append(callCode, shallow.Bytes()...)
+	callCode = append(callCode, byte(GAS), byte(STATICCALL), byte(STOP))
+
+	// pushes 40 items, growing the stack beyond its initial capacity
+	deepCode := bytes.Repeat([]byte{byte(PUSH1), 1}, 40)
+
+	statedb := newTestState(map[common.Address][]byte{
+		shallow: {byte(PUSH1), 1, byte(STOP)},
+		deep:    deepCode,
+		caller:  callCode,
+	})
+
+	counts := func() [4]int64 {
+		return [4]int64{
+			stackPoolGetCounter.Snapshot().Count(), stackPoolMissCounter.Snapshot().Count(),
+			stackPoolPutCounter.Snapshot().Count(), stackPoolDropCounter.Snapshot().Count(),
+		}
+	}
+
+	for i, tt := range []struct {
+		addr       common.Address
+		maxPooled  int
+		gets, puts int64 // cumulative
+		drops      int64
+	}{
+		{shallow, 0, 1, 1, 0},
+		{caller, 0, 3, 3, 0}, // one stack per frame
+		{deep, 0, 4, 4, 0},
+		{deep, 32, 5, 4, 1}, // the grown stack is left to the GC
+	} {
+		evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{MaxPooledStackSize: tt.maxPooled})
+
+		if _, _, err := evm.Call(AccountRef(common.Address{}), tt.addr, nil, 100000, new(big.Int), nil); err != nil {
+			t.Fatalf("run %d: call failed: %v", i, err)
+		}
+
+		have := counts()
+		if have[0] != tt.gets || have[2] != tt.puts || have[3] != tt.drops {
+			t.Errorf("run %d: have %d gets, %d puts, %d drops, want %d, %d, %d", i, have[0], have[2], have[3], tt.gets, tt.puts, tt.drops)
+		}
+
+		// the pool may drop stacks at any GC, so only the share of misses is known
+		if have[1] > have[0] {
+			t.Errorf("run %d: more misses than gets: %d > %d", i, have[1], have[0])
+		}
+	}
+}
+
+func TestMaxReturnDataSize(t *testing.T) {
+	var (
+		returner = common.BytesToAddress([]byte("returner"))
+		caller   = common.BytesToAddress([]byte("caller"))
+		outer    = common.BytesToAddress([]byte("outer"))
+	)
+
+	// callCode returns bytecode calling target with no args or return data
+	callCode := func(target common.Address) []byte {
+		code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)} // retSize, retOffset, argsSize, argsOffset
+		code = append(code, target.Bytes()...)
+
+		return append(code, byte(GAS), byte(STATICCALL), byte(STOP))
+	}
+
+	statedb := newTestState(map[common.Address][]byte{
+		// return(0, 64)
+		returner: {byte(PUSH1), 64, byte(PUSH1), 0, byte(RETURN)},
+		caller:   callCode(returner),
+		outer:    callCode(caller),
+	})
+
+	for _, tt := range []struct {
+		max  uint64
+		addr common.Address
+		err  error
+	}{
+		{0, caller, nil},
+		{64, caller, nil},
+		{63, caller, ErrReturnDataTooLarge},
+		{63, outer, ErrReturnDataTooLarge}, // the callers of the aborted frame are aborted too
+		{63, returner, nil},                // the top-level return data isn't capped
+	} {
+		evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{MaxReturnDataSize: tt.max})
+
+		_, _, err := evm.Call(AccountRef(common.Address{}), tt.addr, nil, 100000, new(big.Int), nil)
+		if err != tt.err {
+			t.Errorf("max %d, call to %x: error mismatch: have %v, want %v", tt.max, tt.addr, err, tt.err)
+		}
+	}
+}
+
+func TestMaxLogDataBytes(t *testing.T) {
+	var (
+		logger = common.BytesToAddress([]byte("logger"))
+		outer  = common.BytesToAddress([]byte("outer"))
+	)
+
+	// log0(0, 40), twice
+	logCode := []byte{byte(PUSH1), 40, byte(PUSH1), 0, byte(LOG0), byte(PUSH1), 40, byte(PUSH1), 0, byte(LOG0), byte(STOP)}
+
+	// log0(0, 40), then calls the logger with no args or return data
+	outerCode := []byte{byte(PUSH1), 40, byte(PUSH1), 0, byte(LOG0)}
+	outerCode = append(outerCode, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20))
+	outerCode = append(outerCode, logger.Bytes()...)
+	outerCode = append(outerCode, byte(GAS), byte(CALL), byte(STOP))
+
+	statedb := newTestState(map[common.Address][]byte{logger: logCode, outer: outerCode})
+
+	for _, tt := range []struct {
+		max  uint64
+		addr common.Address
+		err  error
+	}{
+		{0, outer, nil},
+		{80, logger, nil},
+		{79, logger, ErrLogDataTooLarge},
+		{120, outer, nil},
+		{119, outer, ErrLogDataTooLarge}, // the data of the nested logs adds up, the caller is aborted too
+	} {
+		evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{MaxLogDataBytes: tt.max})
+
+		_, _, err := evm.Call(AccountRef(common.Address{}), tt.addr, nil, 100000, new(big.Int), nil)
+		if err != tt.err {
+			t.Errorf("max %d, call to %x: error mismatch: have %v, want %v", tt.max, tt.addr, err, tt.err)
+		}
+	}
+}
+
+func TestEmptyCodeCallCounter(t *testing.T) {
+	defer func(counter metrics.Counter) { emptyCodeCallCounter = counter }(emptyCodeCallCounter)
+	emptyCodeCallCounter = metrics.NewCounterForced()
+
+	var (
+		eoa    = common.BytesToAddress([]byte("eoa"))
+		caller = common.BytesToAddress([]byte("caller"))
+	)
+
+	// delegatecall(gas, eoa, 0, 0, 0, 0)
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, eoa.Bytes()...)
+	code = append(code, byte(GAS), byte(DELEGATECALL), byte(STOP))
+
+	statedb := newTestState(map[common.Address][]byte{caller: code})
+	statedb.CreateAccount(eoa)
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), eoa, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	if have := emptyCodeCallCounter.Snapshot().Count(); have != 1 {
+		t.Errorf("empty code calls mismatch after a direct call: have %d, want 1", have)
+	}
+
+	// the nested call runs the interpreter on the empty code
+	if _, _, err := evm.Call(AccountRef(common.Address{}), caller, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	if have := emptyCodeCallCounter.Snapshot().Count(); have != 2 {
+		t.Errorf("empty code calls mismatch after a nested call: have %d, want 2", have)
+	}
+}
+
+func TestEnvSnapshot(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+
+	// returns coinbase, timestamp, number, difficulty, gaslimit, basefee and blockhash(number - 1)
+	var code []byte
+	for i, op := range []OpCode{COINBASE, TIMESTAMP, NUMBER, DIFFICULTY, GASLIMIT, BASEFEE} {
+		code = append(code, byte(op), byte(PUSH1), byte(i*32), byte(MSTORE))
+	}
+
+	code = append(code, byte(PUSH1), 1, byte(NUMBER), byte(SUB), byte(BLOCKHASH), byte(PUSH1), 6*32, byte(MSTORE))
+	code = append(code, byte(PUSH1), 7*32, byte(PUSH1), 0, byte(RETURN))
+
+	statedb := newTestState(map[common.Address][]byte{address: code})
+
+	blockContext := func(head uint64) BlockContext {
+		ctx := testBlockContext()
+		ctx.Coinbase = common.BigToAddress(new(big.Int).SetUint64(head))
+		ctx.GasLimit = 30_000_000 + head
+		ctx.BlockNumber = new(big.Int).SetUint64(head)
+		ctx.Time = 1_700_000_000 + 2*head
+		ctx.Difficulty = big.NewInt(int64(head % 7))
+		ctx.BaseFee = big.NewInt(int64(head * 1000))
+		ctx.GetHash = func(n uint64) common.Hash {
+			return common.BigToHash(new(big.Int).SetUint64(n + head<<32))
+		}
+
+		return ctx
+	}
+
+	run := func(ctx BlockContext, env *BlockEnv) []byte {
+		evm := NewEVM(ctx, TxContext{}, statedb, params.AllEthashProtocolChanges, Config{EnvSnapshot: env})
+
+		ret, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil)
+		if err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+
+		return ret
+	}
+
+	original := run(blockContext(100), nil)
+	snapshot := NewBlockEnv(blockContext(100), 99)
+
+	// the chain head has moved on since
+	if rerun := run(blockContext(250), snapshot); !bytes.Equal(rerun, original) {
+		t.Errorf("re-execution with the snapshot mismatch:\nhave %x\nwant %x", rerun, original)
+	}
+
+	if rerun := run(blockContext(250), nil); bytes.Equal(rerun, original) {
+		t.Errorf("re-execution without the snapshot unexpectedly matched")
+	}
+
+	// the snapshot isn't modified by the runs
+	if rerun := run(blockContext(300), snapshot); !bytes.Equal(rerun, original) {
+		t.Errorf("second re-execution with the snapshot mismatch:\nhave %x\nwant %x", rerun, original)
+	}
+}
+
+func TestBaseFeeReads(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{
+		// mstore(0, basefee) return(0, 32) with a second basefee popped
+		address: {byte(BASEFEE), byte(POP), byte(BASEFEE), byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN)},
+	})
+
+	blockContext := testBlockContext()
+	blockContext.BaseFee = big.NewInt(7)
+
+	for _, tt := range []struct {
+		noBaseFee bool
+		applied   bool
+		baseFee   uint64
+	}{
+		{false, false, 7},
+		{true, true, 0},
+	} {
+		evm := NewEVM(blockContext, TxContext{GasPrice: new(big.Int)}, statedb, params.AllEthashProtocolChanges, Config{NoBaseFee: tt.noBaseFee})
+
+		ret, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil)
+		if err != nil {
+			t.Fatalf("NoBaseFee %v: call failed: %v", tt.noBaseFee, err)
+		}
+
+		if have := new(big.Int).SetBytes(ret).Uint64(); have != tt.baseFee {
+			t.Errorf("NoBaseFee %v: base fee mismatch: have %d, want %d", tt.noBaseFee, have, tt.baseFee)
+		}
+
+		if have := evm.Interpreter().NoBaseFeeApplied(); have != tt.applied {
+			t.Errorf("NoBaseFee %v: applied mismatch: have %v, want %v", tt.noBaseFee, have, tt.applied)
+		}
+
+		if have := evm.Interpreter().BaseFeeReads(); have != 2 {
+			t.Errorf("NoBaseFee %v: base fee reads mismatch: have %d, want 2", tt.noBaseFee, have)
+		}
+	}
+}
+
+func TestOnStackPush(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{
+		// add(calldataload(0), calldataload(32)), pop
+		address: {byte(PUSH1), 0, byte(CALLDATALOAD), byte(PUSH1), 32, byte(CALLDATALOAD), byte(ADD), byte(POP), byte(STOP)},
+	})
+
+	type push struct {
+		op    OpCode
+		value uint64
+	}
+
+	var pushes []push
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{
+		OnStackPush: func(op OpCode, value *uint256.Int) {
+			pushes = append(pushes, push{op, value.Uint64()})
+		},
+		StackPushOpcodes: []OpCode{CALLDATALOAD, ADD, POP},
+	})
+
+	input := append(common.LeftPadBytes([]byte{5}, 32), common.LeftPadBytes([]byte{7}, 32)...)
+	if _, _, err := evm.Call(AccountRef(common.Address{}), address, input, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	// POP doesn't push anything
+	want := []push{{CALLDATALOAD, 5}, {CALLDATALOAD, 7}, {ADD, 12}}
+	if !slices.Equal(pushes, want) {
+		t.Errorf("pushes mismatch: have %v, want %v", pushes, want)
+	}
+}
+
+func TestReturnDataOutlivesMemory(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{
+		// mstore(0, calldataload(0)) return(0, 32)
+		address: {byte(PUSH1), 0, byte(CALLDATALOAD), byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN)},
+	})
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+	call := func(input []byte) []byte {
+		ret, _, err := evm.Call(AccountRef(common.Address{}), address, input, 100000, new(big.Int), nil)
+		if err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+
+		return ret
+	}
+
+	first := call(bytes.Repeat([]byte{0x11}, 32))
+
+	// the memory of the first run is reused by the following ones
+	for i := 0; i < 10; i++ {
+		call(bytes.Repeat([]byte{0x22}, 32))
+	}
+
+	if want := bytes.Repeat([]byte{0x11}, 32); !bytes.Equal(first, want) {
+		t.Errorf("return data overwritten: have %x, want %x", first, want)
+	}
+}
+
+// sstoreDiscount is a GasAccountant halving the gas of SSTORE
+type sstoreDiscount struct{}
+
+func (sstoreDiscount) Charge(op OpCode, base, dynamic uint64) uint64 {
+	if op == SSTORE {
+		return (base + dynamic) / 2
+	}
+
+	return base + dynamic
+}
+
+func TestGasAccountant(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+
+	gasUsed := func(accountant GasAccountant) uint64 {
+		statedb := newTestState(map[common.Address][]byte{
+			// sstore(0, 1) stop
+			address: {byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE), byte(STOP)},
+		})
+		statedb.AddAddressToAccessList(address)
+
+		evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{GasAccountant: accountant})
+
+		_, leftOver, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil)
+		if err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+
+		return 100000 - leftOver
+	}
+
+	sstoreGas := params.SstoreSetGasEIP2200 + params.ColdSloadCostEIP2929
+
+	if have, want := gasUsed(nil), 2*GasFastestStep+sstoreGas; have != want {
+		t.Errorf("standard accounting: have %d gas used, want %d", have, want)
+	}
+
+	if have, want := gasUsed(sstoreDiscount{}), 2*GasFastestStep+sstoreGas/2; have != want {
+		t.Errorf("discounted SSTORE: have %d gas used, want %d", have, want)
+	}
+}
+
+func TestSelfDestructSink(t *testing.T) {
+	var (
+		caller      = common.BytesToAddress([]byte("caller"))
+		destructed  = common.BytesToAddress([]byte("destructed"))
+		beneficiary = common.BytesToAddress([]byte("beneficiary"))
+	)
+
+	// the caller calls the destructed contract with no value, args or return data
+	callCode := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	callCode = append(callCode, destructed.Bytes()...)
+	callCode = append(callCode, byte(GAS), byte(CALL), byte(STOP))
+
+	destructCode := append([]byte{byte(PUSH20)}, beneficiary.Bytes()...)
+	destructCode = append(destructCode, byte(SELFDESTRUCT))
+
+	statedb := newTestState(map[common.Address][]byte{
+		caller:     callCode,
+		destructed: destructCode,
+	})
+
+	sink := new(SelfDestructSink)
+	interruptCtx := PutSelfDestructSink(context.Background(), sink)
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), caller, nil, 100000, new(big.Int), interruptCtx); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	want := []SelfDestruct{{Address: destructed, Beneficiary: beneficiary}}
+	if have := sink.SelfDestructs(); !slices.Equal(have, want) {
+		t.Errorf("self-destructs mismatch: have %v, want %v", have, want)
+	}
+
+	// runs without a sink in their context don't report
+	if _, _, err := evm.Call(AccountRef(common.Address{}), caller, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	if have := sink.SelfDestructs(); len(have) != 1 {
+		t.Errorf("self-destruct reported without a sink: %v", have)
+	}
+}
+
+func TestOpcodePolicy(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{
+		// blockhash(number) blockhash(number) pop pop stop
+		address: {byte(NUMBER), byte(BLOCKHASH), byte(NUMBER), byte(BLOCKHASH), byte(POP), byte(POP), byte(STOP)},
+	})
+
+	policy := NewOpcodePolicy(BLOCKHASH, NUMBER, SSTORE)
+	policy.Allow(NUMBER)
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{OpcodePolicy: policy})
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	if have, want := evm.Interpreter().FlaggedOpcodes(), []OpCode{BLOCKHASH}; !slices.Equal(have, want) {
+		t.Errorf("flagged opcodes mismatch: have %v, want %v", have, want)
+	}
+}
+
+func TestCancelInterrupt(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{address: common.Hex2Bytes(loopInterruptTests[0])})
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+
+	interruptCtx, cancel := context.WithCancel(context.Background())
+	errChannel := make(chan error)
+
+	go func() {
+		_, _, err := evm.Call(AccountRef(common.Address{}), address, nil, math.MaxUint64, new(big.Int), interruptCtx)
+		errChannel <- err
+	}()
+
+	cancel()
+
+	select {
+	case <-time.After(time.Second):
+		t.Fatal("cancelled execution timed out")
+	case err := <-errChannel:
+		if !errors.Is(err, context.Canceled) || errors.Is(err, ErrInterrupt) {
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+}
+
+func TestInterruptRetries(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+
+	interruptCtx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+
+	interruptCtx = SetCurrentTxOnContext(interruptCtx, common.HexToHash("0x01"))
+
+	for _, tt := range []struct {
+		retries int
+		want    []error
+	}{
+		{-1, []error{ErrOutOfGas, ErrOutOfGas}},
+		{0, []error{ErrInterrupt, ErrOutOfGas, ErrInterrupt}},
+		{1, []error{ErrInterrupt, ErrOutOfGas, ErrInterrupt}},
+		{2, []error{ErrInterrupt, ErrInterrupt, ErrOutOfGas, ErrInterrupt}},
+	} {
+		cache, _ := lru.New(InterruptedTxCacheSize)
+		ctx := PutCache(interruptCtx, &TxCache{Cache: cache})
+
+		for i, want := range tt.want {
+			// the loop runs out of gas unless it's interrupted
+			statedb := newTestState(map[common.Address][]byte{address: common.Hex2Bytes(loopInterruptTests[0])})
+			evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{InterruptRetries: tt.retries})
+
+			_, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), ctx)
+			if err != want {
+				t.Errorf("retries %d, run %d: have error %v, want %v", tt.retries, i, err, want)
+			}
+		}
+	}
+}
+
+func TestInterruptEscalation(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+
+	interruptCtx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+
+	interruptCtx = SetCurrentTxOnContext(interruptCtx, common.HexToHash("0x01"))
+
+	for _, tt := range []struct {
+		retries    int
+		escalation int
+		want       []error
+	}{
+		{1, 0, []error{ErrInterrupt, ErrOutOfGas, ErrInterrupt, ErrOutOfGas, ErrInterrupt}},
+		{1, 1, []error{ErrInterrupt, ErrOutOfGas, ErrInterruptEscalated, ErrInterruptEscalated}},
+		{1, 2, []error{ErrInterrupt, ErrOutOfGas, ErrInterrupt, ErrOutOfGas, ErrInterruptEscalated}},
+		{-1, 2, []error{ErrOutOfGas, ErrOutOfGas, ErrInterruptEscalated}},
+	} {
+		cache, _ := lru.New(InterruptedTxCacheSize)
+		ctx := PutCache(interruptCtx, &TxCache{Cache: cache})
+
+		for i, want := range tt.want {
+			// the loop runs out of gas unless it's interrupted
+			statedb := newTestState(map[common.Address][]byte{address: common.Hex2Bytes(loopInterruptTests[0])})
+			evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{InterruptRetries: tt.retries, InterruptEscalation: tt.escalation})
+
+			_, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), ctx)
+			if err != want {
+				t.Errorf("retries %d, escalation %d, run %d: have error %v, want %v", tt.retries, tt.escalation, i, err, want)
+			}
+		}
+	}
+
+	if !errors.Is(ErrInterruptEscalated, ErrInterrupt) {
+		t.Errorf("escalated interrupt is not an interrupt")
+	}
+}
+
+func TestOnInterruptRetryScheduled(t *testing.T) {
+	var (
+		address = common.BytesToAddress([]byte("contract"))
+		txHash  = common.HexToHash("0x01")
+	)
+
+	interruptCtx, cancel := context.WithDeadline(context.Background(), time.Now())
+	defer cancel()
+
+	cache, _ := lru.New(InterruptedTxCacheSize)
+	interruptCtx = PutCache(SetCurrentTxOnContext(interruptCtx, txHash), &TxCache{Cache: cache})
+
+	var scheduled []common.Hash
+
+	config := Config{
+		InterruptRetries: 2,
+		OnInterruptRetryScheduled: func(txHash common.Hash) {
+			scheduled = append(scheduled, txHash)
+		},
+	}
+
+	for i, tt := range []struct {
+		err       error
+		scheduled int
+	}{
+		{ErrInterrupt, 0},
+		{ErrInterrupt, 1}, // the last interrupt, the next run is let through
+		{ErrOutOfGas, 1},
+	} {
+		// the loop runs out of gas unless it's interrupted
+		statedb := newTestState(map[common.Address][]byte{address: common.Hex2Bytes(loopInterruptTests[0])})
+		evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, config)
+
+		_, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), interruptCtx)
+		if err != tt.err {
+			t.Errorf("run %d: have error %v, want %v", i, err, tt.err)
+		}
+
+		if len(scheduled) != tt.scheduled {
+			t.Errorf("run %d: have %d callbacks, want %d", i, len(scheduled), tt.scheduled)
+		}
+	}
+
+	if len(scheduled) > 0 && scheduled[0] != txHash {
+		t.Errorf("callback tx: have %v, want %v", scheduled[0], txHash)
+	}
+}
+
+func TestExecutionDuration(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{
+		// jumpdest, push1 0, jump: loops until out of gas
+		address: {byte(JUMPDEST), byte(PUSH1), 0, byte(JUMP)},
+	})
+
+	evm := NewEVM(testBlockContext(), TxContext{GasPrice: new(big.Int)}, statedb, params.AllEthashProtocolChanges, Config{})
+
+	if have := evm.Interpreter().ExecutionDuration(); have != 0 {
+		t.Fatalf("duration before any run: have %v, want 0", have)
+	}
+
+	_, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil)
+	if !errors.Is(err, ErrOutOfGas) {
+		t.Fatalf("unexpected error: have %v, want %v", err, ErrOutOfGas)
+	}
+
+	if have := evm.Interpreter().ExecutionDuration(); have <= 0 {
+		t.Errorf("execution duration not recorded: have %v", have)
+	}
+}
+
+func TestMetricsLabel(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{
+		address: {byte(PUSH1), 1, byte(POP), byte(STOP)},
+	})
+
+	// metrics are disabled in tests, force the labeled counters so the increments are kept
+	counters := map[string]metrics.Counter{}
+
+	for _, label := range []string{"system", "user"} {
+		name := "vm/opcodes/" + label
+		counters[label] = metrics.GetOrRegisterCounterForced(name, nil)
+
+		defer metrics.Unregister(name)
+	}
+
+	evm := NewEVM(testBlockContext(), TxContext{GasPrice: new(big.Int)}, statedb, params.AllEthashProtocolChanges, Config{})
+
+	run := func(label string) {
+		t.Helper()
+
+		ctx := SetMetricsLabelOnContext(context.Background(), label)
+		if _, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), ctx); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	run("system")
+	run("user")
+	run("user")
+
+	if have := counters["system"].Snapshot().Count(); have != 3 {
+		t.Errorf("system opcodes: have %d, want 3", have)
+	}
+
+	if have := counters["user"].Snapshot().Count(); have != 6 {
+		t.Errorf("user opcodes: have %d, want 6", have)
+	}
+
+	if have := GetMetricsLabelFromContext(context.Background()); have != "" {
+		t.Errorf("label of unlabeled context: have %q, want none", have)
+	}
+}
+
+func TestPerCallGasOverhead(t *testing.T) {
+	var (
+		address = common.BytesToAddress([]byte("contract"))
+		callee  = common.BytesToAddress([]byte("callee"))
+	)
+
+	// calls the callee twice with no value, args or return data
+	var code []byte
+
+	for i := 0; i < 2; i++ {
+		code = append(code, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20))
+		code = append(code, callee.Bytes()...)
+		code = append(code, byte(GAS), byte(CALL), byte(POP))
+	}
+
+	code = append(code, byte(STOP))
+
+	gasUsed := func(overhead uint64) uint64 {
+		statedb := newTestState(map[common.Address][]byte{address: code})
+		evm := NewEVM(testBlockContext(), TxContext{GasPrice: new(big.Int)}, statedb, params.AllEthashProtocolChanges, Config{PerCallGasOverhead: overhead})
+
+		_, leftOver, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		return 100000 - leftOver
+	}
+
+	base := gasUsed(0)
+
+	if have := gasUsed(700); have != base+2*700 {
+		t.Errorf("gas used with overhead: have %d, want %d", have, base+2*700)
+	}
+}
+
+func TestDisableValueTransfer(t *testing.T) {
+	var (
+		caller    = common.BytesToAddress([]byte("caller"))
+		recipient = common.BytesToAddress([]byte("recipient"))
+	)
+
+	// calls the recipient with a value of 10 wei and no args or return data
+	code := []byte{
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, // retSize, retOffset, argsSize, argsOffset
+		byte(PUSH1), 10, // value
+		byte(PUSH20),
+	}
+	code = append(code, recipient.Bytes()...)
+	code = append(code, byte(GAS), byte(CALL), byte(STOP))
+
+	blockContext := testBlockContext()
+	blockContext.Transfer = func(db StateDB, sender, recipient common.Address, amount *big.Int) {
+		db.SubBalance(sender, amount)
+		db.AddBalance(recipient, amount)
+	}
+
+	gasUsed := make(map[bool]uint64)
+
+	for _, disabled := range []bool{false, true} {
+		statedb := newTestState(map[common.Address][]byte{caller: code})
+		statedb.AddBalance(caller, big.NewInt(100))
+
+		evm := NewEVM(blockContext, TxContext{GasPrice: new(big.Int)}, statedb, params.AllEthashProtocolChanges, Config{DisableValueTransfer: disabled})
+
+		_, leftOver, err := evm.Call(AccountRef(common.Address{}), caller, nil, 100000, new(big.Int), nil)
+		if err != nil {
+			t.Fatalf("DisableValueTransfer %v: call failed: %v", disabled, err)
+		}
+
+		gasUsed[disabled] = 100000 - leftOver
+
+		want := int64(10)
+		if disabled {
+			want = 0
+		}
+
+		if have := statedb.GetBalance(recipient); have.Cmp(big.NewInt(want)) != 0 {
+			t.Errorf("DisableValueTransfer %v: recipient balance mismatch: have %v, want %d", disabled, have, want)
+		}
+
+		if have := statedb.GetBalance(caller); have.Cmp(big.NewInt(100-want)) != 0 {
+			t.Errorf("DisableValueTransfer %v: caller balance mismatch: have %v, want %d", disabled, have, 100-want)
+		}
+	}
+
+	if gasUsed[true] != gasUsed[false] {
+		t.Errorf("gas used mismatch: have %d with transfers disabled, want %d", gasUsed[true], gasUsed[false])
+	}
+}
+
+func TestRanOutOfGas(t *testing.T) {
+	var (
+		burner   = common.BytesToAddress([]byte("burner"))
+		stopper  = common.BytesToAddress([]byte("stopper"))
+		reverter = common.BytesToAddress([]byte("reverter"))
+		caller   = common.BytesToAddress([]byte("caller"))
+	)
+
+	// calls the burner with 1000 gas and no args or return data
+	callCode := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	callCode = append(callCode, burner.Bytes()...)
+	callCode = append(callCode, byte(PUSH2), 0x03, 0xe8, byte(CALL), byte(STOP))
+
+	statedb := newTestState(map[common.Address][]byte{
+		// jumpdest, push1 0, jump: loops until out of gas
+		burner:   {byte(JUMPDEST), byte(PUSH1), 0, byte(JUMP)},
+		stopper:  {byte(PUSH1), 1, byte(POP), byte(STOP)},
+		reverter: {byte(PUSH1), 0, byte(PUSH1), 0, byte(REVERT)},
+		caller:   callCode,
+	})
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+
+	for _, tt := range []struct {
+		addr common.Address
+		err  error
+		oog  bool
+	}{
+		{burner, ErrOutOfGas, true},
+		{stopper, nil, false},
+		{burner, ErrOutOfGas, true},
+		{reverter, ErrExecutionReverted, false},
+		{caller, nil, false}, // the nested call ran out of gas, the top-level frame didn't
+	} {
+		_, _, err := evm.Call(AccountRef(common.Address{}), tt.addr, nil, 100000, new(big.Int), nil)
+		if err != tt.err {
+			t.Fatalf("call to %x: have error %v, want %v", tt.addr, err, tt.err)
+		}
+
+		if have := evm.Interpreter().RanOutOfGas(); have != tt.oog {
+			t.Errorf("call to %x: have out of gas %t, want %t", tt.addr, have, tt.oog)
+		}
+	}
+}
+
+func TestHadStateWrites(t *testing.T) {
+	var (
+		reader = common.BytesToAddress([]byte("reader"))
+		writer = common.BytesToAddress([]byte("writer"))
+	)
+
+	statedb := newTestState(map[common.Address][]byte{
+		// mstore(0, sload(0)) log0(0, 32) return(0, 32)
+		reader: {
+			byte(PUSH1), 0, byte(SLOAD), byte(PUSH1), 0, byte(MSTORE),
+			byte(PUSH1), 32, byte(PUSH1), 0, byte(LOG0),
+			byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN),
+		},
+		// sstore(0, 1)
+		writer: {byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE)},
+	})
+	statedb.AddAddressToAccessList(writer)
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+
+	for _, tt := range []struct {
+		addr   common.Address
+		writes bool
+	}{
+		{reader, false},
+		{writer, true},
+		{reader, false},
+	} {
+		_, _, err := evm.Call(AccountRef(common.Address{}), tt.addr, nil, 100000, new(big.Int), nil)
+		if err != nil {
+			t.Fatalf("call to %x failed: %v", tt.addr, err)
+		}
+
+		if have := evm.Interpreter().HadStateWrites(); have != tt.writes {
+			t.Errorf("call to %x: state writes mismatch: have %v, want %v", tt.addr, have, tt.writes)
+		}
+	}
+}
+
+func TestRegisterOpcode(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{
+		// mstore(0, custom()) return(0, 32)
+		address: {0x0c, byte(PUSH1), 0, byte(MSTORE), byte(PUSH1), 32, byte(PUSH1), 0, byte(RETURN)},
+	})
+
+	// pushes 42
+	custom := func(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+		scope.Stack.push(uint256.NewInt(42))
+		return nil, nil
+	}
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+	if err := evm.Interpreter().RegisterOpcode(0x0c, custom, GasQuickStep, minStack(0, 1), maxStack(0, 1)); err != nil {
+		t.Fatalf("failed to register opcode: %v", err)
+	}
+
+	ret, leftOver, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil)
+	if err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	if have := new(big.Int).SetBytes(ret).Uint64(); have != 42 {
+		t.Errorf("result mismatch: have %d, want 42", have)
+	}
+
+	// the custom opcode, 3 pushes, mstore expanding the memory by a word and return
+	if have, want := 100000-leftOver, GasQuickStep+3*GasFastestStep+GasFastestStep+3; have != want {
+		t.Errorf("gas used mismatch: have %d, want %d", have, want)
+	}
+
+	// other interpreters keep the standard jump table
+	evm = NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+	if _, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); !errors.As(err, new(*ErrInvalidOpCode)) {
+		t.Errorf("unexpected error without the custom opcode: %v", err)
+	}
+
+	// on mainnet only undefined opcodes can be registered
+	evm = NewEVM(testBlockContext(), TxContext{}, statedb, params.MainnetChainConfig, Config{})
+	if err := evm.Interpreter().RegisterOpcode(ADD, custom, GasQuickStep, minStack(0, 1), maxStack(0, 1)); !errors.Is(err, ErrOpcodeOverride) {
+		t.Errorf("overriding ADD on mainnet: have error %v, want %v", err, ErrOpcodeOverride)
+	}
+
+	if err := evm.Interpreter().RegisterOpcode(0x0c, custom, GasQuickStep, minStack(0, 1), maxStack(0, 1)); err != nil {
+		t.Errorf("failed to register opcode on mainnet: %v", err)
+	}
+}
+
+// scopeTracer records the contract and code address of every step by depth
+type scopeTracer struct {
+	addresses map[int][2]common.Address
+}
+
+func (t *scopeTracer) CaptureTxStart(gasLimit uint64) {}
+func (t *scopeTracer) CaptureTxEnd(restGas uint64)    {}
+func (t *scopeTracer) CaptureStart(env *EVM, from common.Address, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+func (t *scopeTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+func (t *scopeTracer) CaptureEnter(typ OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+func (t *scopeTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+func (t *scopeTracer) CaptureState(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, rData []byte, depth int, err error) {
+	t.addresses[depth] = [2]common.Address{scope.Contract.Address(), scope.CodeAddress()}
+}
+func (t *scopeTracer) CaptureFault(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, depth int, err error) {
+}
+
+func TestScopeCodeAddress(t *testing.T) {
+	var (
+		caller  = common.BytesToAddress([]byte("caller"))
+		library = common.BytesToAddress([]byte("library"))
+	)
+
+	// delegatecalls the library with no args or return data
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, library.Bytes()...)
+	code = append(code, byte(GAS), byte(DELEGATECALL), byte(STOP))
+
+	statedb := newTestState(map[common.Address][]byte{
+		caller:  code,
+		library: {byte(STOP)},
+	})
+
+	tracer := &scopeTracer{addresses: make(map[int][2]common.Address)}
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{Tracer: tracer})
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), caller, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	want := map[int][2]common.Address{
+		1: {caller, caller},
+		2: {caller, library},
+	}
+	if !reflect.DeepEqual(tracer.addresses, want) {
+		t.Errorf("scope addresses mismatch: have %x, want %x", tracer.addresses, want)
+	}
+}
+
+// costTracer records the cost of every step by opcode
+type costTracer struct {
+	scopeTracer
+	costs map[OpCode]uint64
+}
+
+func (t *costTracer) CaptureState(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, rData []byte, depth int, err error) {
+	t.costs[op] = cost
+}
+
+func TestTraceNetCost(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+
+	for _, tt := range []struct {
+		net  bool
+		cost uint64
+	}{
+		// resetting a cold slot
+		{false, params.SstoreResetGasEIP2200},
+		// with the refund for clearing it deducted
+		{true, params.SstoreResetGasEIP2200 - params.SstoreClearsScheduleRefundEIP3529},
+	} {
+		// sstore(0, 0) clearing a slot set before
+		statedb := newTestState(map[common.Address][]byte{
+			address: {byte(PUSH1), 0, byte(PUSH1), 0, byte(SSTORE)},
+		})
+		statedb.SetState(address, common.Hash{}, common.BigToHash(big.NewInt(1)))
+		statedb.IntermediateRoot(true)
+		statedb.AddAddressToAccessList(address)
+
+		tracer := &costTracer{costs: make(map[OpCode]uint64)}
+		evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{Tracer: tracer, TraceNetCost: tt.net})
+
+		_, leftOver, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil)
+		if err != nil {
+			t.Fatalf("net %v: call failed: %v", tt.net, err)
+		}
+
+		if have := tracer.costs[SSTORE]; have != tt.cost {
+			t.Errorf("net %v: SSTORE cost mismatch: have %d, want %d", tt.net, have, tt.cost)
+		}
+
+		// the gas charged isn't affected
+		if have, want := 100000-leftOver, 2*GasFastestStep+params.SstoreResetGasEIP2200; have != want {
+			t.Errorf("net %v: gas used mismatch: have %d, want %d", tt.net, have, want)
+		}
+	}
+}
+
+func TestOnRefund(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+
+	// sstore(0, 0) clearing a slot set before, sstore(0, 1) restoring it
+	statedb := newTestState(map[common.Address][]byte{
+		address: {byte(PUSH1), 0, byte(PUSH1), 0, byte(SSTORE), byte(PUSH1), 1, byte(PUSH1), 0, byte(SSTORE)},
+	})
+	statedb.SetState(address, common.Hash{}, common.BigToHash(big.NewInt(1)))
+	statedb.IntermediateRoot(true)
+	statedb.AddAddressToAccessList(address)
+
+	type refundEvent struct {
+		op    OpCode
+		delta int64
+		pc    uint64
+	}
+
+	var events []refundEvent
+
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{
+		OnRefund: func(op OpCode, delta int64, pc uint64) {
+			events = append(events, refundEvent{op, delta, pc})
+		},
+	})
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	// restoring the original value takes back the clearing refund, and refunds most of the reset instead
+	restoreRefund := int64(params.SstoreResetGasEIP2200 - params.ColdSloadCostEIP2929 - params.WarmStorageReadCostEIP2929)
+	want := []refundEvent{
+		{SSTORE, int64(params.SstoreClearsScheduleRefundEIP3529), 4},
+		{SSTORE, restoreRefund - int64(params.SstoreClearsScheduleRefundEIP3529), 9},
+	}
+
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("refund events mismatch: have %+v, want %+v", events, want)
+	}
+}
+
+// stepTracer records the code address of every traced step
+type stepTracer struct {
+	scopeTracer
+	steps []common.Address
+}
+
+func (t *stepTracer) CaptureState(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, rData []byte, depth int, err error) {
+	t.steps = append(t.steps, scope.CodeAddress())
+}
+
+func TestTraceAddressFilter(t *testing.T) {
+	var (
+		outer  = common.BytesToAddress([]byte("outer"))
+		middle = common.BytesToAddress([]byte("middle"))
+		inner  = common.BytesToAddress([]byte("inner"))
+	)
+
+	// callCode returns bytecode calling target with no args, value or return data
+	callCode := func(target common.Address) []byte {
+		code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+		code = append(code, target.Bytes()...)
+
+		return append(code, byte(GAS), byte(CALL), byte(POP), byte(STOP))
+	}
+
+	statedb := newTestState(map[common.Address][]byte{
+		outer:  callCode(middle),
+		middle: callCode(inner),
+		inner:  {byte(PUSH1), 1, byte(POP), byte(STOP)},
+	})
+
+	for _, tt := range []struct {
+		filter map[common.Address]bool
+		steps  map[common.Address]int
+	}{
+		{nil, map[common.Address]int{outer: 10, middle: 10, inner: 3}},
+		{map[common.Address]bool{middle: true}, map[common.Address]int{middle: 10}},
+		{map[common.Address]bool{outer: true, inner: true}, map[common.Address]int{outer: 10, inner: 3}},
+	} {
+		tracer := &stepTracer{}
+		evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{Tracer: tracer, TraceAddressFilter: tt.filter})
+
+		if _, _, err := evm.Call(AccountRef(common.Address{}), outer, nil, 100000, new(big.Int), nil); err != nil {
+			t.Fatalf("filter %v: call failed: %v", tt.filter, err)
+		}
+
+		steps := make(map[common.Address]int)
+		for _, addr := range tracer.steps {
+			steps[addr]++
+		}
+
+		if !reflect.DeepEqual(steps, tt.steps) {
+			t.Errorf("filter %v: traced steps mismatch: have %v, want %v", tt.filter, steps, tt.steps)
+		}
+	}
+}
+
+func TestOnCallGasBreakdown(t *testing.T) {
+	var (
+		contract  = common.BytesToAddress([]byte("contract"))
+		recipient = common.BytesToAddress([]byte("recipient"))
+	)
+
+	// calls the empty recipient with 10 wei and 4096 gas, the 32 bytes of return data expand the memory
+	code := []byte{
+		byte(PUSH1), 32, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, // retSize, retOffset, argsSize, argsOffset
+		byte(PUSH1), 10, // value
+		byte(PUSH20),
+	}
+	code = append(code, recipient.Bytes()...)
+	code = append(code, byte(PUSH2), 0x10, 0x00, byte(CALL), byte(STOP))
+
+	blockContext := testBlockContext()
+	blockContext.Transfer = func(db StateDB, sender, recipient common.Address, amount *big.Int) {
+		db.SubBalance(sender, amount)
+		db.AddBalance(recipient, amount)
+	}
+
+	statedb := newTestState(map[common.Address][]byte{contract: code})
+	statedb.AddBalance(contract, big.NewInt(100))
+
+	type event struct {
+		op        OpCode
+		pc        uint64
+		breakdown CallGasBreakdown
+	}
+
+	var events []event
+
+	evm := NewEVM(blockContext, TxContext{GasPrice: new(big.Int)}, statedb, params.AllEthashProtocolChanges, Config{
+		OnCallGasBreakdown: func(op OpCode, pc uint64, breakdown CallGasBreakdown) {
+			events = append(events, event{op, pc, breakdown})
+		},
+	})
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), contract, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	want := []event{{
+		op: CALL,
+		pc: 34,
+		breakdown: CallGasBreakdown{
+			Memory:        3,
+			ValueTransfer: params.CallValueTransferGas,
+			NewAccount:    params.CallNewAccountGas,
+			ColdAccess:    params.ColdAccountAccessCostEIP2929 - params.WarmStorageReadCostEIP2929,
+			Forwarded:     4096,
+			Stipend:       params.CallStipend,
+		},
+	}}
+
+	if !reflect.DeepEqual(events, want) {
+		t.Errorf("breakdown mismatch: have %+v, want %+v", events, want)
+	}
+}
+
+func TestNoSubCalls(t *testing.T) {
+	var (
+		contract = common.BytesToAddress([]byte("contract"))
+		callee   = common.BytesToAddress([]byte("callee"))
+	)
+
+	// sstore(0, call(callee)), sstore(1, delegatecall(callee)), sstore(2, 1)
+	code := []byte{byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20)}
+	code = append(code, callee.Bytes()...)
+	code = append(code, byte(GAS), byte(CALL), byte(PUSH1), 0, byte(SSTORE))
+	code = append(code, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH20))
+	code = append(code, callee.Bytes()...)
+	code = append(code, byte(GAS), byte(DELEGATECALL), byte(PUSH1), 1, byte(SSTORE))
+	code = append(code, byte(PUSH1), 1, byte(PUSH1), 2, byte(SSTORE), byte(STOP))
+
+	for _, noSubCalls := range []bool{false, true} {
+		statedb := newTestState(map[common.Address][]byte{
+			contract: code,
+			// sstore(5, 1)
+			callee: {byte(PUSH1), 1, byte(PUSH1), 5, byte(SSTORE), byte(STOP)},
+		})
+		statedb.AddAddressToAccessList(contract)
+
+		evm := NewEVM(testBlockContext(), TxContext{GasPrice: new(big.Int)}, statedb, params.AllEthashProtocolChanges, Config{NoSubCalls: noSubCalls})
+
+		if _, _, err := evm.Call(AccountRef(common.Address{}), contract, nil, 1000000, new(big.Int), nil); err != nil {
+			t.Fatalf("NoSubCalls %v: call failed: %v", noSubCalls, err)
+		}
+
+		succeeded := common.Hash{}
+		if !noSubCalls {
+			succeeded = common.BigToHash(big.NewInt(1))
+		}
+
+		for slot, want := range map[int64]common.Hash{0: succeeded, 1: succeeded, 2: common.BigToHash(big.NewInt(1)), 5: succeeded} {
+			if have := statedb.GetState(contract, common.BigToHash(big.NewInt(slot))); have != want {
+				t.Errorf("NoSubCalls %v: slot %d of the caller is %x, want %x", noSubCalls, slot, have, want)
+			}
+		}
+
+		if have := statedb.GetState(callee, common.BigToHash(big.NewInt(5))); have != succeeded {
+			t.Errorf("NoSubCalls %v: slot 5 of the callee is %x, want %x", noSubCalls, have, succeeded)
+		}
+	}
+}
+
+func TestTableName(t *testing.T) {
+	forks := *params.AllDevChainProtocolChanges
+	forks.BerlinBlock = big.NewInt(10)
+	forks.LondonBlock, forks.ArrowGlacierBlock, forks.GrayGlacierBlock = big.NewInt(20), big.NewInt(20), big.NewInt(20)
+	forks.ShanghaiBlock = big.NewInt(30)
+	forks.CancunBlock = big.NewInt(40)
+	forks.PragueBlock, forks.VerkleBlock = nil, nil
+
+	tests := []struct {
+		config *params.ChainConfig
+		number int64
+		want   string
+	}{
+		{&params.ChainConfig{ChainID: big.NewInt(1)}, 0, "frontier"},
+		{&forks, 0, "istanbul"},
+		{&forks, 10, "berlin"},
+		{&forks, 25, "london"},
+		{&forks, 30, "shanghai"},
+		{&forks, 40, "cancun"},
+	}
+
+	for _, tt := range tests {
+		blockContext := testBlockContext()
+		blockContext.BlockNumber = big.NewInt(tt.number)
+
+		evm := NewEVM(blockContext, TxContext{}, newTestState(nil), tt.config, Config{})
+		if have := evm.Interpreter().TableName(); have != tt.want {
+			t.Errorf("block %d: have table %q, want %q", tt.number, have, tt.want)
+		}
+	}
+}
+
+func TestWatchSlots(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	watched := StorageKey{Address: address, Slot: common.BigToHash(big.NewInt(1))}
+
+	// sload(1), sstore(2, 5), sstore(1, 7)
+	code := []byte{
+		byte(PUSH1), 1, byte(SLOAD), byte(POP),
+		byte(PUSH1), 5, byte(PUSH1), 2, byte(SSTORE),
+		byte(PUSH1), 7, byte(PUSH1), 1, byte(SSTORE),
+		byte(STOP),
+	}
+
+	type access struct {
+		op OpCode
+		pc uint64
+	}
+
+	var accesses []access
+
+	statedb := newTestState(map[common.Address][]byte{address: code})
+	statedb.AddAddressToAccessList(address)
+
+	evm := NewEVM(testBlockContext(), TxContext{GasPrice: new(big.Int)}, statedb, params.AllEthashProtocolChanges, Config{
+		WatchSlots: map[StorageKey]bool{watched: true},
+		OnWatchedSlot: func(key StorageKey, op OpCode, pc uint64) error {
+			if key != watched {
+				t.Errorf("reported slot %x of %x, want the watched one", key.Slot, key.Address)
+			}
+
+			accesses = append(accesses, access{op, pc})
+
+			return nil
+		},
+	})
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if want := []access{{SLOAD, 2}, {SSTORE, 13}}; !reflect.DeepEqual(accesses, want) {
+		t.Errorf("watched accesses: have %v, want %v", accesses, want)
+	}
+
+	// without a callback the first access aborts the run
+	evm = NewEVM(testBlockContext(), TxContext{GasPrice: new(big.Int)}, statedb, params.AllEthashProtocolChanges, Config{
+		WatchSlots: map[StorageKey]bool{watched: true},
+	})
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); !errors.Is(err, ErrWatchedSlot) {
+		t.Errorf("have error %v, want %v", err, ErrWatchedSlot)
+	}
+
+	// an access in a nested call aborts the whole run as well, not only the call
+	caller := common.BytesToAddress([]byte("caller"))
+	callerCode := []byte{
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, // retSize, retOffset, argsSize, argsOffset, value
+		byte(PUSH20),
+	}
+	callerCode = append(callerCode, address.Bytes()...)
+	callerCode = append(callerCode, byte(GAS), byte(CALL), byte(STOP))
+
+	statedb.SetCode(caller, callerCode)
+	statedb.AddAddressToAccessList(caller)
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), caller, nil, 100000, new(big.Int), nil); !errors.Is(err, ErrWatchedSlot) {
+		t.Errorf("nested call: have error %v, want %v", err, ErrWatchedSlot)
+	}
+}
+
+func TestSetStackValidator(t *testing.T) {
+	var (
+		valid   = common.BytesToAddress([]byte("valid"))
+		invalid = common.BytesToAddress([]byte("invalid"))
+	)
+
+	statedb := newTestState(map[common.Address][]byte{
+		// drops 1 more item
+		valid: {byte(PUSH1), 7, byte(PUSH1), 1, 0x0c, byte(STOP)},
+		// drops 3 more items of an empty stack
+		invalid: {byte(PUSH1), 3, 0x0c, byte(STOP)},
+	})
+
+	// pops n, then n more items
+	dropN := func(pc *uint64, interpreter *EVMInterpreter, scope *ScopeContext) ([]byte, error) {
+		n := scope.Stack.pop()
+		for i := uint64(0); i < n.Uint64(); i++ {
+			scope.Stack.pop()
+		}
+
+		return nil, nil
+	}
+
+	errShortStack := errors.New("stack too short for the number of items to drop")
+	validate := func(stack *Stack) error {
+		data := stack.Data()
+		if len(data) == 0 || !stack.Back(0).IsUint64() || stack.Back(0).Uint64() >= uint64(len(data)) {
+			return errShortStack
+		}
+
+		return nil
+	}
+
+	for _, tt := range []struct {
+		name string
+		addr common.Address
+		want error
+	}{{"valid", valid, nil}, {"invalid", invalid, errShortStack}} {
+		evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+		if err := evm.Interpreter().SetStackValidator(0x0c, validate); err == nil {
+			t.Errorf("validator set for an opcode which isn't registered")
+		}
+
+		// the registered stack bounds would accept any stack
+		if err := evm.Interpreter().RegisterOpcode(0x0c, dropN, GasQuickStep, 0, int(params.StackLimit)); err != nil {
+			t.Fatalf("failed to register opcode: %v", err)
+		}
+
+		if err := evm.Interpreter().SetStackValidator(0x0c, validate); err != nil {
+			t.Fatalf("failed to set the stack validator: %v", err)
+		}
+
+		if _, _, err := evm.Call(AccountRef(common.Address{}), tt.addr, nil, 100000, new(big.Int), nil); !errors.Is(err, tt.want) {
+			t.Errorf("%s: have error %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+// latencyHistogram records the values of a histogram, regardless of whether metrics are enabled
+type latencyHistogram struct {
+	metrics.NilHistogram
+	values []int64
+}
+
+func (h *latencyHistogram) Update(v int64) { h.values = append(h.values, v) }
+
+func TestInterruptLatency(t *testing.T) {
+	histogram := new(latencyHistogram)
+
+	defer func(h metrics.Histogram) { interruptLatencyHistogram = h }(interruptLatencyHistogram)
+	interruptLatencyHistogram = histogram
+
+	address := common.BytesToAddress([]byte("contract"))
+
+	// the interrupt arrived 10ms before the run started
+	deadline := time.Now().Add(-10 * time.Millisecond)
+
+	interruptCtx, cancel := context.WithDeadline(context.Background(), deadline)
+	defer cancel()
+
+	cache, _ := lru.New(InterruptedTxCacheSize)
+	interruptCtx = PutCache(SetCurrentTxOnContext(interruptCtx, common.HexToHash("0x01")), &TxCache{Cache: cache})
+
+	statedb := newTestState(map[common.Address][]byte{address: common.Hex2Bytes(loopInterruptTests[0])})
+	evm := NewEVM(testBlockContext(), TxContext{}, statedb, params.AllEthashProtocolChanges, Config{})
+
+	before := time.Now()
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), address, nil, 100000, new(big.Int), interruptCtx); err != ErrInterrupt {
+		t.Fatalf("have error %v, want %v", err, ErrInterrupt)
+	}
+
+	if len(histogram.values) != 1 {
+		t.Fatalf("have %d latencies, want 1", len(histogram.values))
+	}
+
+	// the latency spans from the deadline to the abort
+	if latency, min, max := time.Duration(histogram.values[0]), before.Sub(deadline), time.Since(deadline); latency < min || latency > max {
+		t.Errorf("latency %v outside of [%v, %v]", latency, min, max)
+	}
+
+	// a context cancelled before its deadline has no latency to record
+	cancelledCtx, cancel := context.WithDeadline(context.Background(), time.Now().Add(time.Hour))
+	cancel()
+
+	countOpcodeInterrupt(cancelledCtx)
+
+	if len(histogram.values) != 1 {
+		t.Errorf("cancelled: have %d latencies, want 1", len(histogram.values))
+	}
+}
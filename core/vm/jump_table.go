@@ -42,8 +42,17 @@ type operation struct {
 
 	// memorySize returns the memory size required for the operation
 	memorySize memorySizeFunc
+
+	// undefined is set for the opcodes which aren't part of the instruction set
+	undefined bool
+
+	// validateStack replaces the minStack and maxStack check if set, see EVMInterpreter.SetStackValidator
+	validateStack StackValidator
 }
 
+// StackValidator checks whether an opcode can be executed on the stack, see EVMInterpreter.SetStackValidator
+type StackValidator func(stack *Stack) error
+
 var (
 	frontierInstructionSet         = newFrontierInstructionSet()
 	homesteadInstructionSet        = newHomesteadInstructionSet()
@@ -1070,7 +1079,7 @@ func newFrontierInstructionSet() JumpTable {
 	// Fill all unassigned slots with opUndefined.
 	for i, entry := range tbl {
 		if entry == nil {
-			tbl[i] = &operation{execute: opUndefined, maxStack: maxStack(0, 0)}
+			tbl[i] = &operation{execute: opUndefined, maxStack: maxStack(0, 0), undefined: true}
 		}
 	}
 
@@ -75,3 +75,9 @@ func (op *operation) HasCost() bool {
 	// filter out
 	return op.dynamicGas != nil || op.constantGas != 0
 }
+
+// ConstantGas returns the constant gas charged by the opcode, on top of its
+// dynamic gas, if any.
+func (op *operation) ConstantGas() uint64 {
+	return op.constantGas
+}
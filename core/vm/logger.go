@@ -41,3 +41,12 @@ type EVMLogger interface {
 	CaptureState(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, rData []byte, depth int, err error)
 	CaptureFault(pc uint64, op OpCode, gas, cost uint64, scope *ScopeContext, depth int, err error)
 }
+
+// AccessLogger is an EVMLogger which is also notified of the EIP-2929 accesses to accounts
+// and storage slots charged by an opcode, before its CaptureState. warm tells whether the
+// account or slot was in the access list already.
+type AccessLogger interface {
+	EVMLogger
+	CaptureAccountAccess(addr common.Address, warm bool)
+	CaptureSlotAccess(addr common.Address, slot common.Hash, warm bool)
+}
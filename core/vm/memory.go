@@ -17,18 +17,45 @@
 package vm
 
 import (
+	"fmt"
+	"sync"
+
 	"github.com/holiman/uint256"
 )
 
+// maxPooledMemory is the largest memory returned to the pool, bigger ones are left to the GC to
+// reduce the peak allocation
+const maxPooledMemory = 16 << 10
+
+var memoryPool = sync.Pool{
+	New: func() interface{} {
+		return &Memory{}
+	},
+}
+
 // Memory implements a simple memory model for the ethereum virtual machine.
 type Memory struct {
-	store       []byte
-	lastGasCost uint64
+	store         []byte
+	lastGasCost   uint64
+	verifyZeroing bool // panic if Resize exposes reused capacity which isn't zero, see Config.VerifyMemoryZeroing
 }
 
-// NewMemory returns a new memory model.
+// NewMemory returns a new memory model. It's taken from a pool, so txs which are
+// interrupted and retried don't reallocate their memory.
 func NewMemory() *Memory {
-	return &Memory{}
+	return memoryPool.Get().(*Memory)
+}
+
+// Free returns the memory to the pool, it mustn't be used afterwards. The contents are
+// cleared, so the capacity reused by the next user is zero even before Resize zeroes it.
+func (m *Memory) Free() {
+	if cap(m.store) <= maxPooledMemory {
+		clear(m.store)
+		m.store = m.store[:0]
+		m.lastGasCost = 0
+		m.verifyZeroing = false
+		memoryPool.Put(m)
+	}
 }
 
 // Set sets offset + size to value
@@ -62,10 +89,26 @@ func (m *Memory) Set32(offset uint64, val *uint256.Int) {
 // Resize resizes the memory to size
 func (m *Memory) Resize(size uint64) {
 	if uint64(m.Len()) < size {
+		if m.verifyZeroing {
+			m.checkZeroed(size)
+		}
+
 		m.store = append(m.store, make([]byte, size-uint64(m.Len()))...)
 	}
 }
 
+// checkZeroed panics if the capacity which a resize to size reuses has a byte which isn't zero
+func (m *Memory) checkZeroed(size uint64) {
+	exposed := m.store[len(m.store):min(uint64(cap(m.store)), size)]
+
+	for i, b := range exposed {
+		if b != 0 {
+			panic(fmt.Sprintf("stale memory: byte %#x at offset %d exposed by resize from %d to %d (capacity %d)",
+				b, len(m.store)+i, len(m.store), size, cap(m.store)))
+		}
+	}
+}
+
 // GetCopy returns offset + size as a new slice
 func (m *Memory) GetCopy(offset, size int64) (cpy []byte) {
 	if size == 0 {
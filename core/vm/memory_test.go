@@ -2,6 +2,7 @@ package vm
 
 import (
 	"bytes"
+	"fmt"
 	"strings"
 	"testing"
 
@@ -67,3 +68,67 @@ func TestMemoryCopy(t *testing.T) {
 		}
 	}
 }
+
+func TestMemoryReuse(t *testing.T) {
+	for i := 0; i < 10; i++ {
+		m := NewMemory()
+		if m.Len() != 0 || m.lastGasCost != 0 {
+			t.Fatalf("run %d: memory not reset: len %d, last gas cost %d", i, m.Len(), m.lastGasCost)
+		}
+
+		m.Resize(1024)
+
+		if have := m.Data(); !bytes.Equal(have, make([]byte, 1024)) {
+			t.Fatalf("run %d: stale bytes in reused memory: %x", i, have)
+		}
+
+		m.Set(0, 1024, bytes.Repeat([]byte{0xff}, 1024))
+		m.lastGasCost = 100
+		m.Free()
+	}
+}
+
+func BenchmarkMemoryPool(b *testing.B) {
+	run := func(newMemory func() *Memory, free func(*Memory)) func(b *testing.B) {
+		return func(b *testing.B) {
+			b.ReportAllocs()
+
+			for i := 0; i < b.N; i++ {
+				m := newMemory()
+				m.Resize(4096)
+				free(m)
+			}
+		}
+	}
+
+	b.Run("pooled", run(NewMemory, (*Memory).Free))
+	b.Run("unpooled", run(func() *Memory { return &Memory{} }, func(*Memory) {}))
+}
+
+func TestMemoryVerifyZeroing(t *testing.T) {
+	// a pooled memory whose contents weren't cleared before it was reused
+	stale := &Memory{store: bytes.Repeat([]byte{0xaa}, 64)[:32], verifyZeroing: true}
+
+	func() {
+		defer func() {
+			r := recover()
+			if r == nil {
+				t.Fatal("resize exposing stale bytes didn't panic")
+			}
+
+			if want := "byte 0xaa at offset 32 exposed by resize from 32 to 64"; !strings.Contains(fmt.Sprint(r), want) {
+				t.Errorf("panic diagnostics: have %q, want %q", r, want)
+			}
+		}()
+
+		stale.Resize(64)
+	}()
+
+	// spare capacity which is zero passes the check
+	m := &Memory{store: make([]byte, 32, 64), verifyZeroing: true}
+	m.Resize(64)
+
+	if !bytes.Equal(m.Data(), make([]byte, 64)) {
+		t.Errorf("resized memory not zeroed: %x", m.Data())
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+// OpcodePolicy is an allow/deny list of opcodes. Executing a denied opcode doesn't
+// fail, the interpreter records it instead, see EVMInterpreter.FlaggedOpcodes.
+// Block-STM uses it to execute txs serially which run opcodes whose results may
+// depend on the tx order in ways the MVHashMap doesn't track.
+type OpcodePolicy struct {
+	denied [256]bool
+}
+
+// NewOpcodePolicy creates a policy allowing all opcodes but the denied ones.
+func NewOpcodePolicy(denied ...OpCode) *OpcodePolicy {
+	p := new(OpcodePolicy)
+	for _, op := range denied {
+		p.Deny(op)
+	}
+
+	return p
+}
+
+// Deny flags the opcode.
+func (p *OpcodePolicy) Deny(op OpCode) {
+	p.denied[op] = true
+}
+
+// Allow removes the flag of the opcode.
+func (p *OpcodePolicy) Allow(op OpCode) {
+	p.denied[op] = false
+}
+
+// Denied returns whether the opcode is flagged.
+func (p *OpcodePolicy) Denied(op OpCode) bool {
+	return p.denied[op]
+}
@@ -38,7 +38,10 @@ func makeGasSStoreFunc(clearingRefund uint64) gasFunc {
 			cost    = uint64(0)
 		)
 		// Check slot presence in the access list
-		if addrPresent, slotPresent := evm.StateDB.SlotInAccessList(contract.Address(), slot); !slotPresent {
+		addrPresent, slotPresent := evm.StateDB.SlotInAccessList(contract.Address(), slot)
+		captureSlotAccess(evm, contract.Address(), slot, slotPresent)
+
+		if !slotPresent {
 			cost = params.ColdSloadCostEIP2929
 			// If the caller cannot afford the cost, this change will be rolled back
 			evm.StateDB.AddSlotToAccessList(contract.Address(), slot)
@@ -110,7 +113,10 @@ func gasSLoadEIP2929(evm *EVM, contract *Contract, stack *Stack, mem *Memory, me
 	loc := stack.peek()
 	slot := common.Hash(loc.Bytes32())
 	// Check slot presence in the access list
-	if _, slotPresent := evm.StateDB.SlotInAccessList(contract.Address(), slot); !slotPresent {
+	_, slotPresent := evm.StateDB.SlotInAccessList(contract.Address(), slot)
+	captureSlotAccess(evm, contract.Address(), slot, slotPresent)
+
+	if !slotPresent {
 		// If the caller cannot afford the cost, this change will be rolled back
 		// If he does afford it, we can skip checking the same thing later on, during execution
 		evm.StateDB.AddSlotToAccessList(contract.Address(), slot)
@@ -134,7 +140,10 @@ func gasExtCodeCopyEIP2929(evm *EVM, contract *Contract, stack *Stack, mem *Memo
 
 	addr := common.Address(stack.peek().Bytes20())
 	// Check slot presence in the access list
-	if !evm.StateDB.AddressInAccessList(addr) {
+	warm := evm.StateDB.AddressInAccessList(addr)
+	captureAccountAccess(evm, addr, warm)
+
+	if !warm {
 		evm.StateDB.AddAddressToAccessList(addr)
 
 		var overflow bool
@@ -159,7 +168,10 @@ func gasExtCodeCopyEIP2929(evm *EVM, contract *Contract, stack *Stack, mem *Memo
 func gasEip2929AccountCheck(evm *EVM, contract *Contract, stack *Stack, mem *Memory, memorySize uint64) (uint64, error) {
 	addr := common.Address(stack.peek().Bytes20())
 	// Check slot presence in the access list
-	if !evm.StateDB.AddressInAccessList(addr) {
+	warm := evm.StateDB.AddressInAccessList(addr)
+	captureAccountAccess(evm, addr, warm)
+
+	if !warm {
 		// If the caller cannot afford the cost, this change will be rolled back
 		evm.StateDB.AddAddressToAccessList(addr)
 		// The warm storage read cost is already charged as constantGas
@@ -174,6 +186,7 @@ func makeCallVariantGasCallEIP2929(oldCalculator gasFunc) gasFunc {
 		addr := common.Address(stack.Back(1).Bytes20())
 		// Check slot presence in the access list
 		warmAccess := evm.StateDB.AddressInAccessList(addr)
+		captureAccountAccess(evm, addr, warmAccess)
 		// The WarmStorageReadCostEIP2929 (100) is already deducted in the form of a constant cost, so
 		// the cost to charge for cold access, if any, is Cold - Warm
 		coldCost := params.ColdAccountAccessCostEIP2929 - params.WarmStorageReadCostEIP2929
@@ -200,6 +213,7 @@ func makeCallVariantGasCallEIP2929(oldCalculator gasFunc) gasFunc {
 		// outside of this function, as part of the dynamic gas, and that will make it
 		// also become correctly reported to tracers.
 		contract.Gas += coldCost
+		evm.callGasBreakdown.ColdAccess = coldCost
 
 		return gas + coldCost, nil
 	}
@@ -241,7 +255,10 @@ func makeSelfdestructGasFn(refundsEnabled bool) gasFunc {
 			address = common.Address(stack.peek().Bytes20())
 		)
 
-		if !evm.StateDB.AddressInAccessList(address) {
+		warm := evm.StateDB.AddressInAccessList(address)
+		captureAccountAccess(evm, address, warm)
+
+		if !warm {
 			// If the caller cannot afford the cost, this change will be rolled back
 			evm.StateDB.AddAddressToAccessList(address)
 
@@ -260,3 +277,17 @@ func makeSelfdestructGasFn(refundsEnabled bool) gasFunc {
 
 	return gasFunc
 }
+
+// captureAccountAccess reports an EIP-2929 account access to the tracer, if it's an AccessLogger
+func captureAccountAccess(evm *EVM, addr common.Address, warm bool) {
+	if tracer, ok := evm.Config.Tracer.(AccessLogger); ok {
+		tracer.CaptureAccountAccess(addr, warm)
+	}
+}
+
+// captureSlotAccess reports an EIP-2929 storage slot access to the tracer, if it's an AccessLogger
+func captureSlotAccess(evm *EVM, addr common.Address, slot common.Hash, warm bool) {
+	if tracer, ok := evm.Config.Tracer.(AccessLogger); ok {
+		tracer.CaptureSlotAccess(addr, slot, warm)
+	}
+}
@@ -0,0 +1,314 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package runtime
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// Recording holds all the external inputs of a call, so it can be re-executed by Replay without
+// the state it originally ran against. The results of nested calls aren't recorded as such, they
+// follow from the recorded state of the called accounts.
+type Recording struct {
+	Origin     common.Address
+	GasPrice   *big.Int
+	BlobHashes []common.Hash
+
+	Address common.Address
+	Input   []byte
+	Gas     uint64
+	Value   *big.Int
+
+	// Env is the block information, including the hashes read by BLOCKHASH
+	Env *vm.BlockEnv
+
+	// Accounts is the state of every account accessed by the call, as it was before the call
+	Accounts map[common.Address]*RecordedAccount
+}
+
+// RecordedAccount is the state of an account before a recorded call. Storage only holds the
+// slots accessed by the call.
+type RecordedAccount struct {
+	Exists  bool
+	Balance *big.Int
+	Nonce   uint64
+	Code    []byte
+	Storage map[common.Hash]common.Hash
+}
+
+// Recorder wraps the StateDB of an EVM, recording the state of every account and storage slot
+// as it was before the first access to it, see Record.
+type Recorder struct {
+	vm.StateDB
+
+	accounts map[common.Address]*RecordedAccount
+	hashes   map[uint64]common.Hash
+}
+
+// NewRecorder returns a Recorder reading from and writing to db
+func NewRecorder(db vm.StateDB) *Recorder {
+	return &Recorder{
+		StateDB:  db,
+		accounts: make(map[common.Address]*RecordedAccount),
+		hashes:   make(map[uint64]common.Hash),
+	}
+}
+
+// GetHash wraps getHash to record the block hashes read through it
+func (r *Recorder) GetHash(getHash vm.GetHashFunc) vm.GetHashFunc {
+	return func(n uint64) common.Hash {
+		hash := getHash(n)
+		r.hashes[n] = hash
+
+		return hash
+	}
+}
+
+// Accounts returns the recorded state of the accounts accessed so far
+func (r *Recorder) Accounts() map[common.Address]*RecordedAccount {
+	return r.accounts
+}
+
+// BlockHashes returns the block hashes read through GetHash so far
+func (r *Recorder) BlockHashes() map[uint64]common.Hash {
+	return r.hashes
+}
+
+func (r *Recorder) touch(addr common.Address) *RecordedAccount {
+	account, ok := r.accounts[addr]
+	if !ok {
+		account = &RecordedAccount{
+			Exists:  r.StateDB.Exist(addr),
+			Balance: new(big.Int).Set(r.StateDB.GetBalance(addr)),
+			Nonce:   r.StateDB.GetNonce(addr),
+			Code:    common.CopyBytes(r.StateDB.GetCode(addr)),
+		}
+		r.accounts[addr] = account
+	}
+
+	return account
+}
+
+func (r *Recorder) touchSlot(addr common.Address, key common.Hash) {
+	account := r.touch(addr)
+	if account.Storage == nil {
+		account.Storage = make(map[common.Hash]common.Hash)
+	}
+
+	if _, ok := account.Storage[key]; !ok {
+		// the committed state is the value before the tx, even if the slot was written already
+		account.Storage[key] = r.StateDB.GetCommittedState(addr, key)
+	}
+}
+
+func (r *Recorder) CreateAccount(addr common.Address) {
+	r.touch(addr)
+	r.StateDB.CreateAccount(addr)
+}
+
+func (r *Recorder) SubBalance(addr common.Address, amount *big.Int) {
+	r.touch(addr)
+	r.StateDB.SubBalance(addr, amount)
+}
+
+func (r *Recorder) AddBalance(addr common.Address, amount *big.Int) {
+	r.touch(addr)
+	r.StateDB.AddBalance(addr, amount)
+}
+
+func (r *Recorder) GetBalance(addr common.Address) *big.Int {
+	r.touch(addr)
+	return r.StateDB.GetBalance(addr)
+}
+
+func (r *Recorder) GetNonce(addr common.Address) uint64 {
+	r.touch(addr)
+	return r.StateDB.GetNonce(addr)
+}
+
+func (r *Recorder) SetNonce(addr common.Address, nonce uint64) {
+	r.touch(addr)
+	r.StateDB.SetNonce(addr, nonce)
+}
+
+func (r *Recorder) GetCodeHash(addr common.Address) common.Hash {
+	r.touch(addr)
+	return r.StateDB.GetCodeHash(addr)
+}
+
+func (r *Recorder) GetCode(addr common.Address) []byte {
+	r.touch(addr)
+	return r.StateDB.GetCode(addr)
+}
+
+func (r *Recorder) SetCode(addr common.Address, code []byte) {
+	r.touch(addr)
+	r.StateDB.SetCode(addr, code)
+}
+
+func (r *Recorder) GetCodeSize(addr common.Address) int {
+	r.touch(addr)
+	return r.StateDB.GetCodeSize(addr)
+}
+
+func (r *Recorder) GetCommittedState(addr common.Address, key common.Hash) common.Hash {
+	r.touchSlot(addr, key)
+	return r.StateDB.GetCommittedState(addr, key)
+}
+
+func (r *Recorder) GetState(addr common.Address, key common.Hash) common.Hash {
+	r.touchSlot(addr, key)
+	return r.StateDB.GetState(addr, key)
+}
+
+func (r *Recorder) SetState(addr common.Address, key, value common.Hash) {
+	r.touchSlot(addr, key)
+	r.StateDB.SetState(addr, key, value)
+}
+
+func (r *Recorder) SelfDestruct(addr common.Address) {
+	r.touch(addr)
+	r.StateDB.SelfDestruct(addr)
+}
+
+func (r *Recorder) HasSelfDestructed(addr common.Address) bool {
+	r.touch(addr)
+	return r.StateDB.HasSelfDestructed(addr)
+}
+
+func (r *Recorder) Selfdestruct6780(addr common.Address) {
+	r.touch(addr)
+	r.StateDB.Selfdestruct6780(addr)
+}
+
+func (r *Recorder) Exist(addr common.Address) bool {
+	r.touch(addr)
+	return r.StateDB.Exist(addr)
+}
+
+func (r *Recorder) Empty(addr common.Address) bool {
+	r.touch(addr)
+	return r.StateDB.Empty(addr)
+}
+
+// Record calls address like Call and returns the recording of the call, which can be re-executed
+// by Replay. The chain config and the EVMConfig aren't part of the recording, Replay must be given
+// the same ones.
+func Record(address common.Address, input []byte, cfg *Config) ([]byte, uint64, *Recording, error) {
+	setDefaults(cfg)
+
+	var (
+		recorder = NewRecorder(cfg.State)
+		vmenv    = NewEnv(cfg)
+		ctx      = vmenv.Context
+		rules    = cfg.ChainConfig.Rules(ctx.BlockNumber, ctx.Random != nil, ctx.Time)
+	)
+
+	// the context already holds the env snapshot, if there's one, which would replace the recording GetHash
+	evmConfig := cfg.EVMConfig
+	evmConfig.EnvSnapshot = nil
+
+	ctx.GetHash = recorder.GetHash(ctx.GetHash)
+	vmenv = vm.NewEVM(ctx, vmenv.TxContext, recorder, cfg.ChainConfig, evmConfig)
+
+	recorder.Prepare(rules, cfg.Origin, cfg.Coinbase, &address, vm.ActivePrecompiles(rules), nil)
+
+	ret, leftOverGas, err := vmenv.Call(vm.AccountRef(cfg.Origin), address, input, cfg.GasLimit, cfg.Value, nil)
+
+	env := vm.NewBlockEnv(ctx)
+	env.BlockHashes = recorder.BlockHashes()
+
+	recording := &Recording{
+		Origin:     cfg.Origin,
+		GasPrice:   new(big.Int).Set(cfg.GasPrice),
+		BlobHashes: cfg.BlobHashes,
+		Address:    address,
+		Input:      common.CopyBytes(input),
+		Gas:        cfg.GasLimit,
+		Value:      new(big.Int).Set(cfg.Value),
+		Env:        env,
+		Accounts:   recorder.Accounts(),
+	}
+
+	return ret, leftOverGas, recording, err
+}
+
+// State returns an in-memory state holding the recorded accounts
+func (rec *Recording) State() (*state.StateDB, error) {
+	statedb, err := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	for addr, account := range rec.Accounts {
+		if !account.Exists {
+			continue
+		}
+
+		statedb.CreateAccount(addr)
+		statedb.SetBalance(addr, account.Balance)
+		statedb.SetNonce(addr, account.Nonce)
+		statedb.SetCode(addr, account.Code)
+
+		for key, value := range account.Storage {
+			statedb.SetState(addr, key, value)
+		}
+	}
+
+	// the recorded values become the committed state, which the SSTORE gas is based on
+	statedb.Finalise(false)
+
+	return statedb, nil
+}
+
+// Replay re-executes a recorded call against the recorded state only, returning the same results
+// as the recorded run. The state of cfg and its block information are replaced by the recording.
+func Replay(rec *Recording, cfg *Config) ([]byte, uint64, error) {
+	if cfg == nil {
+		cfg = new(Config)
+	}
+
+	statedb, err := rec.State()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	cfg.State = statedb
+	cfg.Origin = rec.Origin
+	cfg.GasPrice = rec.GasPrice
+	cfg.BlobHashes = rec.BlobHashes
+	cfg.GasLimit = rec.Gas
+	cfg.Value = rec.Value
+	cfg.EVMConfig.EnvSnapshot = rec.Env
+
+	setDefaults(cfg)
+
+	var (
+		vmenv = NewEnv(cfg)
+		rules = cfg.ChainConfig.Rules(vmenv.Context.BlockNumber, vmenv.Context.Random != nil, vmenv.Context.Time)
+	)
+
+	statedb.Prepare(rules, cfg.Origin, vmenv.Context.Coinbase, &rec.Address, vm.ActivePrecompiles(rules), nil)
+
+	return vmenv.Call(vm.AccountRef(cfg.Origin), rec.Address, rec.Input, cfg.GasLimit, cfg.Value, nil)
+}
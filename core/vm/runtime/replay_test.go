@@ -0,0 +1,120 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package runtime
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
+	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+func TestRecordReplay(t *testing.T) {
+	var (
+		caller = common.BytesToAddress([]byte("caller"))
+		callee = common.BytesToAddress([]byte("callee"))
+		holder = common.BytesToAddress([]byte("holder"))
+	)
+
+	// returns balance(holder) + timestamp
+	calleeCode := append([]byte{byte(vm.PUSH20)}, holder.Bytes()...)
+	calleeCode = append(calleeCode,
+		byte(vm.BALANCE), byte(vm.TIMESTAMP), byte(vm.ADD),
+		byte(vm.PUSH1), 0, byte(vm.MSTORE),
+		byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN),
+	)
+
+	// increments slot 0, then returns blockhash(number - 1), the result of the callee, slot 0 and the coinbase
+	callerCode := []byte{
+		byte(vm.PUSH1), 0, byte(vm.SLOAD), byte(vm.PUSH1), 1, byte(vm.ADD), byte(vm.PUSH1), 0, byte(vm.SSTORE),
+		byte(vm.PUSH1), 1, byte(vm.NUMBER), byte(vm.SUB), byte(vm.BLOCKHASH), byte(vm.PUSH1), 0, byte(vm.MSTORE),
+		byte(vm.PUSH1), 32, byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, // retSize, retOffset, argsSize, argsOffset
+		byte(vm.PUSH20),
+	}
+	callerCode = append(callerCode, callee.Bytes()...)
+	callerCode = append(callerCode,
+		byte(vm.GAS), byte(vm.STATICCALL), byte(vm.POP),
+		byte(vm.PUSH1), 0, byte(vm.SLOAD), byte(vm.PUSH1), 64, byte(vm.MSTORE),
+		byte(vm.COINBASE), byte(vm.PUSH1), 96, byte(vm.MSTORE),
+		byte(vm.PUSH1), 128, byte(vm.PUSH1), 0, byte(vm.RETURN),
+	)
+
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	statedb.SetCode(caller, callerCode)
+	statedb.SetState(caller, common.Hash{}, common.BigToHash(big.NewInt(41)))
+	statedb.SetCode(callee, calleeCode)
+	statedb.SetBalance(holder, big.NewInt(1000))
+	statedb.Finalise(true)
+
+	ret, leftOverGas, recording, err := Record(caller, nil, &Config{
+		State:       statedb,
+		BlockNumber: big.NewInt(100),
+		Time:        5,
+		Coinbase:    common.BytesToAddress([]byte("coinbase")),
+		GasLimit:    100000,
+	})
+	if err != nil {
+		t.Fatalf("recorded run failed: %v", err)
+	}
+
+	want := make([]byte, 0, 128)
+	want = append(want, defaultGetHash(99).Bytes()...)
+	want = append(want, common.BigToHash(big.NewInt(1005)).Bytes()...)
+	want = append(want, common.BigToHash(big.NewInt(42)).Bytes()...)
+	want = append(want, common.BytesToHash(common.BytesToAddress([]byte("coinbase")).Bytes()).Bytes()...)
+
+	if !bytes.Equal(ret, want) {
+		t.Fatalf("recorded run returned %x, want %x", ret, want)
+	}
+
+	for _, addr := range []common.Address{caller, callee, holder} {
+		if _, ok := recording.Accounts[addr]; !ok {
+			t.Errorf("account %x not recorded", addr)
+		}
+	}
+
+	if have := recording.Accounts[caller].Storage[common.Hash{}]; have != common.BigToHash(big.NewInt(41)) {
+		t.Errorf("recorded slot 0 is %x, want the value before the run", have)
+	}
+
+	// the replay doesn't get the original state nor the block information
+	replayRet, replayGas, err := Replay(recording, nil)
+	if err != nil {
+		t.Fatalf("replay failed: %v", err)
+	}
+
+	if !bytes.Equal(replayRet, ret) {
+		t.Errorf("replay returned %x, want %x", replayRet, ret)
+	}
+
+	if replayGas != leftOverGas {
+		t.Errorf("replay left %d gas, want %d", replayGas, leftOverGas)
+	}
+}
+
+// defaultGetHash is the GetHashFn set by setDefaults
+func defaultGetHash(n uint64) common.Hash {
+	cfg := new(Config)
+	setDefaults(cfg)
+
+	return cfg.GetHashFn(n)
+}
@@ -19,11 +19,22 @@ package vm
 import (
 	"sync"
 
+	"github.com/ethereum/go-ethereum/metrics"
+
 	"github.com/holiman/uint256"
 )
 
+var (
+	stackPoolGetCounter  = metrics.NewRegisteredCounter("vm/stackpool/gets", nil)   // stacks taken from the pool
+	stackPoolMissCounter = metrics.NewRegisteredCounter("vm/stackpool/misses", nil) // stacks allocated as the pool was empty
+	stackPoolPutCounter  = metrics.NewRegisteredCounter("vm/stackpool/puts", nil)   // stacks returned to the pool
+	stackPoolDropCounter = metrics.NewRegisteredCounter("vm/stackpool/drops", nil)  // stacks left to the GC, see Config.MaxPooledStackSize
+)
+
 var stackPool = sync.Pool{
 	New: func() interface{} {
+		stackPoolMissCounter.Inc(1)
+
 		return &Stack{data: make([]uint256.Int, 0, 16)}
 	},
 }
@@ -36,12 +47,22 @@ type Stack struct {
 }
 
 func newstack() *Stack {
+	stackPoolGetCounter.Inc(1)
+
 	return stackPool.Get().(*Stack)
 }
 
-func returnStack(s *Stack) {
+// returnStack returns the stack to the pool, unless it grew beyond maxPooled items (0 = no limit)
+func returnStack(s *Stack, maxPooled int) {
+	if maxPooled > 0 && cap(s.data) > maxPooled {
+		stackPoolDropCounter.Inc(1)
+
+		return
+	}
+
 	s.data = s.data[:0]
 	stackPool.Put(s)
+	stackPoolPutCounter.Inc(1)
 }
 
 // Data returns the underlying uint256.Int array.
@@ -0,0 +1,151 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// AccountDiff is the net change of an account by a tx, see Config.RecordStateDiff
+type AccountDiff struct {
+	BalanceBefore, BalanceAfter *big.Int
+	NonceBefore, NonceAfter     uint64
+
+	// Storage holds the values before and after of the changed slots
+	Storage map[common.Hash][2]common.Hash
+}
+
+type accountState struct {
+	balance *big.Int
+	nonce   uint64
+}
+
+// stateDiffRecorder wraps the StateDB of an EVM, recording the value of every account and slot before
+// the first write to it, so the net changes can be determined by comparing them to the current values.
+type stateDiffRecorder struct {
+	StateDB
+
+	accounts map[common.Address]accountState
+	slots    map[common.Address]map[common.Hash]common.Hash
+}
+
+func newStateDiffRecorder(db StateDB) *stateDiffRecorder {
+	return &stateDiffRecorder{
+		StateDB:  db,
+		accounts: make(map[common.Address]accountState),
+		slots:    make(map[common.Address]map[common.Hash]common.Hash),
+	}
+}
+
+func (r *stateDiffRecorder) touchAccount(addr common.Address) {
+	if _, ok := r.accounts[addr]; !ok {
+		r.accounts[addr] = accountState{balance: new(big.Int).Set(r.StateDB.GetBalance(addr)), nonce: r.StateDB.GetNonce(addr)}
+	}
+}
+
+func (r *stateDiffRecorder) CreateAccount(addr common.Address) {
+	r.touchAccount(addr)
+	r.StateDB.CreateAccount(addr)
+}
+
+func (r *stateDiffRecorder) SubBalance(addr common.Address, amount *big.Int) {
+	r.touchAccount(addr)
+	r.StateDB.SubBalance(addr, amount)
+}
+
+func (r *stateDiffRecorder) AddBalance(addr common.Address, amount *big.Int) {
+	r.touchAccount(addr)
+	r.StateDB.AddBalance(addr, amount)
+}
+
+func (r *stateDiffRecorder) SetNonce(addr common.Address, nonce uint64) {
+	r.touchAccount(addr)
+	r.StateDB.SetNonce(addr, nonce)
+}
+
+func (r *stateDiffRecorder) SelfDestruct(addr common.Address) {
+	r.touchAccount(addr)
+	r.StateDB.SelfDestruct(addr)
+}
+
+func (r *stateDiffRecorder) Selfdestruct6780(addr common.Address) {
+	r.touchAccount(addr)
+	r.StateDB.Selfdestruct6780(addr)
+}
+
+func (r *stateDiffRecorder) SetState(addr common.Address, key, value common.Hash) {
+	slots, ok := r.slots[addr]
+	if !ok {
+		slots = make(map[common.Hash]common.Hash)
+		r.slots[addr] = slots
+	}
+
+	if _, ok := slots[key]; !ok {
+		slots[key] = r.StateDB.GetState(addr, key)
+	}
+
+	r.StateDB.SetState(addr, key, value)
+}
+
+// diff returns the accounts whose balance, nonce or storage differs from before the first write
+func (r *stateDiffRecorder) diff() map[common.Address]*AccountDiff {
+	diff := make(map[common.Address]*AccountDiff)
+
+	get := func(addr common.Address) *AccountDiff {
+		if d, ok := diff[addr]; ok {
+			return d
+		}
+
+		before, ok := r.accounts[addr]
+		if !ok {
+			before = accountState{balance: new(big.Int).Set(r.StateDB.GetBalance(addr)), nonce: r.StateDB.GetNonce(addr)}
+		}
+
+		d := &AccountDiff{
+			BalanceBefore: before.balance,
+			BalanceAfter:  new(big.Int).Set(r.StateDB.GetBalance(addr)),
+			NonceBefore:   before.nonce,
+			NonceAfter:    r.StateDB.GetNonce(addr),
+		}
+		diff[addr] = d
+
+		return d
+	}
+
+	for addr, before := range r.accounts {
+		if before.balance.Cmp(r.StateDB.GetBalance(addr)) != 0 || before.nonce != r.StateDB.GetNonce(addr) {
+			get(addr)
+		}
+	}
+
+	for addr, slots := range r.slots {
+		for key, before := range slots {
+			if after := r.StateDB.GetState(addr, key); after != before {
+				d := get(addr)
+				if d.Storage == nil {
+					d.Storage = make(map[common.Hash][2]common.Hash)
+				}
+
+				d.Storage[key] = [2]common.Hash{before, after}
+			}
+		}
+	}
+
+	return diff
+}
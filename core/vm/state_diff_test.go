@@ -0,0 +1,92 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package vm
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+func TestStateDiff(t *testing.T) {
+	var (
+		contract  = common.BytesToAddress([]byte("contract"))
+		recipient = common.BytesToAddress([]byte("recipient"))
+	)
+
+	// sstore(0, 5), sstore(1, 7), sstore(1, 0) restoring slot 1, then calls the recipient with 10 wei
+	code := []byte{
+		byte(PUSH1), 5, byte(PUSH1), 0, byte(SSTORE),
+		byte(PUSH1), 7, byte(PUSH1), 1, byte(SSTORE),
+		byte(PUSH1), 0, byte(PUSH1), 1, byte(SSTORE),
+		byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, byte(PUSH1), 0, // retSize, retOffset, argsSize, argsOffset
+		byte(PUSH1), 10, // value
+		byte(PUSH20),
+	}
+	code = append(code, recipient.Bytes()...)
+	code = append(code, byte(GAS), byte(CALL), byte(STOP))
+
+	blockContext := testBlockContext()
+	blockContext.Transfer = func(db StateDB, sender, recipient common.Address, amount *big.Int) {
+		db.SubBalance(sender, amount)
+		db.AddBalance(recipient, amount)
+	}
+
+	statedb := newTestState(map[common.Address][]byte{contract: code})
+	statedb.AddBalance(contract, big.NewInt(100))
+	statedb.AddAddressToAccessList(contract)
+
+	evm := NewEVM(blockContext, TxContext{GasPrice: new(big.Int)}, statedb, params.AllEthashProtocolChanges, Config{RecordStateDiff: true})
+
+	if _, _, err := evm.Call(AccountRef(common.Address{}), contract, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	want := map[common.Address]*AccountDiff{
+		contract: {
+			BalanceBefore: big.NewInt(100),
+			BalanceAfter:  big.NewInt(90),
+			Storage:       map[common.Hash][2]common.Hash{{}: {{}, common.BigToHash(big.NewInt(5))}},
+		},
+		recipient: {
+			BalanceBefore: new(big.Int),
+			BalanceAfter:  big.NewInt(10),
+		},
+	}
+
+	if have := evm.StateDiff(); !reflect.DeepEqual(have, want) {
+		t.Errorf("state diff mismatch")
+
+		for addr, diff := range have {
+			t.Logf("have %x: %+v", addr, diff)
+		}
+	}
+
+	// the diff starts over with the next tx
+	evm.Reset(TxContext{GasPrice: new(big.Int)}, statedb)
+
+	if have := evm.StateDiff(); len(have) != 0 {
+		t.Errorf("state diff of a new tx: have %d accounts, want none", len(have))
+	}
+
+	if evm := NewEVM(blockContext, TxContext{}, statedb, params.AllEthashProtocolChanges, Config{}); evm.StateDiff() != nil {
+		t.Errorf("state diff recorded without RecordStateDiff")
+	}
+}
@@ -628,6 +628,9 @@ func TestIOdump(t *testing.T) {
 
 	*ioflag = true
 
+	// the dump is written to the trace path, keep it out of the source tree
+	path := t.TempDir()
+
 	var testSuite = []struct {
 		blockNumber rpc.BlockNumber
 		config      *TraceConfig
@@ -638,6 +641,7 @@ func TestIOdump(t *testing.T) {
 		{
 			config: &TraceConfig{
 				IOFlag: ioflag,
+				Path:   &path,
 			},
 			blockNumber: rpc.BlockNumber(genBlocks),
 			want:        `[{"result":{"gas":21000,"failed":false,"returnValue":"","structLogs":[]}},{"result":{"gas":21000,"failed":false,"returnValue":"","structLogs":[]}},{"result":{"gas":21000,"failed":false,"returnValue":"","structLogs":[]}},{"result":{"gas":21000,"failed":false,"returnValue":"","structLogs":[]}},{"result":{"gas":21000,"failed":false,"returnValue":"","structLogs":[]}}]`,
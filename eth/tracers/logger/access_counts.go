@@ -0,0 +1,83 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// AccessCountTracer is an EVM tracer counting the cold and warm accesses to
+// accounts and storage slots by the opcodes of the last top-level call,
+// including those of nested calls, as charged by EIP-2929. Accesses before
+// Berlin aren't counted.
+type AccessCountTracer struct {
+	coldAccounts, warmAccounts int
+	coldSlots, warmSlots       int
+}
+
+// NewAccessCountTracer creates a new access count tracer.
+func NewAccessCountTracer() *AccessCountTracer {
+	return &AccessCountTracer{}
+}
+
+func (t *AccessCountTracer) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	*t = AccessCountTracer{}
+}
+
+func (t *AccessCountTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+}
+
+func (t *AccessCountTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *AccessCountTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+
+func (t *AccessCountTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *AccessCountTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *AccessCountTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *AccessCountTracer) CaptureTxEnd(restGas uint64) {}
+
+// CaptureAccountAccess counts an account access.
+func (t *AccessCountTracer) CaptureAccountAccess(addr common.Address, warm bool) {
+	if warm {
+		t.warmAccounts++
+	} else {
+		t.coldAccounts++
+	}
+}
+
+// CaptureSlotAccess counts a storage slot access.
+func (t *AccessCountTracer) CaptureSlotAccess(addr common.Address, slot common.Hash, warm bool) {
+	if warm {
+		t.warmSlots++
+	} else {
+		t.coldSlots++
+	}
+}
+
+// AccessCounts returns the number of cold and warm accesses to accounts and
+// storage slots in the last top-level call.
+func (t *AccessCountTracer) AccessCounts() (coldAccounts, warmAccounts, coldSlots, warmSlots int) {
+	return t.coldAccounts, t.warmAccounts, t.coldSlots, t.warmSlots
+}
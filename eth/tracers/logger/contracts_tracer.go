@@ -0,0 +1,66 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// ContractsTracer is an EVM tracer recording the distinct code addresses
+// executed in the last top-level call, including delegated code.
+type ContractsTracer struct {
+	touched map[common.Address]struct{}
+}
+
+// NewContractsTracer creates a new contracts tracer.
+func NewContractsTracer() *ContractsTracer {
+	return &ContractsTracer{touched: make(map[common.Address]struct{})}
+}
+
+func (t *ContractsTracer) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	clear(t.touched)
+}
+
+// CaptureState records the code address of the executing contract.
+func (t *ContractsTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if addr := scope.Contract.CodeAddr; addr != nil {
+		t.touched[*addr] = struct{}{}
+	}
+}
+
+func (t *ContractsTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *ContractsTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+
+func (t *ContractsTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *ContractsTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *ContractsTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *ContractsTracer) CaptureTxEnd(restGas uint64) {}
+
+// ContractsTouched returns the number of distinct code addresses executed in
+// the last top-level call.
+func (t *ContractsTracer) ContractsTouched() int {
+	return len(t.touched)
+}
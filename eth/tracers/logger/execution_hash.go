@@ -0,0 +1,73 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"encoding/binary"
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// ExecutionHashTracer is an EVM tracer computing a rolling hash over the pc,
+// opcode, gas before the opcode and stack size of every opcode executed in the
+// last top-level call, including those of nested calls. Runs of the same tx
+// yielding different hashes diverged.
+type ExecutionHashTracer struct {
+	hasher crypto.KeccakState
+	buf    [21]byte // Encoding of an opcode for hasher
+}
+
+// NewExecutionHashTracer creates a new execution hash tracer.
+func NewExecutionHashTracer() *ExecutionHashTracer {
+	return &ExecutionHashTracer{hasher: crypto.NewKeccakState()}
+}
+
+func (t *ExecutionHashTracer) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.hasher.Reset()
+}
+
+// CaptureState adds op to the hash.
+func (t *ExecutionHashTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	buf := t.buf[:]
+	binary.BigEndian.PutUint64(buf[0:8], pc)
+	buf[8] = byte(op)
+	binary.BigEndian.PutUint64(buf[9:17], gas)
+	binary.BigEndian.PutUint32(buf[17:21], uint32(len(scope.Stack.Data())))
+	t.hasher.Write(buf)
+}
+
+func (t *ExecutionHashTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *ExecutionHashTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+
+func (t *ExecutionHashTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *ExecutionHashTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *ExecutionHashTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *ExecutionHashTracer) CaptureTxEnd(restGas uint64) {}
+
+// ExecutionHash returns the hash of the last top-level call.
+func (t *ExecutionHashTracer) ExecutionHash() common.Hash {
+	return common.BytesToHash(t.hasher.Sum(nil))
+}
@@ -0,0 +1,57 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+// frameSteps tracks the last step of every frame on the call stack. The effects of an opcode,
+// e.g. the gas returned by a call, only show at the next step of its frame or when the frame
+// exits, so tracers complete a step there.
+type frameSteps[T any] struct {
+	frames []*T // pending step of every frame, nil if there's none
+}
+
+func (f *frameSteps[T]) reset() {
+	f.frames = f.frames[:0]
+}
+
+// enter adds a frame without a pending step
+func (f *frameSteps[T]) enter() {
+	f.frames = append(f.frames, nil)
+}
+
+// exit removes the innermost frame and returns its pending step, if any
+func (f *frameSteps[T]) exit() *T {
+	if len(f.frames) == 0 {
+		return nil
+	}
+
+	step := f.frames[len(f.frames)-1]
+	f.frames = f.frames[:len(f.frames)-1]
+
+	return step
+}
+
+// swap makes step the pending step of the innermost frame and returns the previous one, if any
+func (f *frameSteps[T]) swap(step *T) *T {
+	if len(f.frames) == 0 {
+		f.enter()
+	}
+
+	prev := f.frames[len(f.frames)-1]
+	f.frames[len(f.frames)-1] = step
+
+	return prev
+}
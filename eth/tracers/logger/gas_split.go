@@ -0,0 +1,88 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// GasSplitTracer is an EVM tracer splitting the gas used by the last top-level
+// call, including nested calls, into the constant gas of the executed opcodes
+// and the dynamic gas, e.g. for memory expansion or state access. The
+// vm.Config.PerCallGasOverhead charged by calls and creates is in neither.
+type GasSplitTracer struct {
+	table    vm.JumpTable
+	overhead uint64 // vm.Config.PerCallGasOverhead of the traced EVM
+
+	static    uint64
+	overheads uint64 // Overhead charged by the calls and creates so far
+	dynamic   uint64
+}
+
+// NewGasSplitTracer creates a new gas split tracer.
+func NewGasSplitTracer() *GasSplitTracer {
+	return &GasSplitTracer{}
+}
+
+func (t *GasSplitTracer) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	// the forks without an instruction set of their own fall back to the latest one
+	rules := env.ChainConfig().Rules(env.Context.BlockNumber, env.Context.Random != nil, env.Context.Time)
+	t.table, _ = vm.LookupInstructionSet(rules)
+	t.overhead = env.Config.PerCallGasOverhead
+
+	t.static, t.overheads, t.dynamic = 0, 0, 0
+}
+
+// CaptureState accounts the constant gas of op, once all of its gas was charged.
+func (t *GasSplitTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if err != nil {
+		return
+	}
+
+	t.static += t.table[op].ConstantGas()
+
+	switch op {
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL, vm.CREATE, vm.CREATE2:
+		t.overheads += t.overhead
+	}
+}
+
+func (t *GasSplitTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+// CaptureEnd accounts the rest of the gas used as dynamic gas.
+func (t *GasSplitTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	t.dynamic = gasUsed - t.static - t.overheads
+}
+
+func (t *GasSplitTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *GasSplitTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *GasSplitTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *GasSplitTracer) CaptureTxEnd(restGas uint64) {}
+
+// GasSplit returns the constant and the dynamic gas used by the last top-level
+// call.
+func (t *GasSplitTracer) GasSplit() (static, dynamic uint64) {
+	return t.static, t.dynamic
+}
@@ -0,0 +1,86 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// LogTracer is an EVM tracer recording the LOG events emitted in the last
+// top-level call in order, including those of nested calls. Events of reverted
+// calls are included.
+type LogTracer struct {
+	logs []*types.Log
+}
+
+// NewLogTracer creates a new log tracer.
+func NewLogTracer() *LogTracer {
+	return &LogTracer{}
+}
+
+func (t *LogTracer) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.logs = nil
+}
+
+// CaptureState records the event of a LOG opcode about to be executed.
+func (t *LogTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if err != nil || op < vm.LOG0 || op > vm.LOG4 {
+		return
+	}
+
+	stack := scope.Stack
+	mStart, mSize := stack.Back(0), stack.Back(1)
+
+	topics := make([]common.Hash, op-vm.LOG0)
+	for i := range topics {
+		topics[i] = stack.Back(2 + i).Bytes32()
+	}
+
+	t.logs = append(t.logs, &types.Log{
+		Address: scope.Contract.Address(),
+		Topics:  topics,
+		Data:    scope.Memory.GetCopy(int64(mStart.Uint64()), int64(mSize.Uint64())),
+	})
+}
+
+// CaptureFault drops the event of a LOG opcode failing to execute, e.g. in a
+// static call.
+func (t *LogTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	if op >= vm.LOG0 && op <= vm.LOG4 && len(t.logs) > 0 {
+		t.logs = t.logs[:len(t.logs)-1]
+	}
+}
+
+func (t *LogTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+
+func (t *LogTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *LogTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *LogTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *LogTracer) CaptureTxEnd(restGas uint64) {}
+
+// Logs returns the LOG events emitted in the last top-level call.
+func (t *LogTracer) Logs() []*types.Log {
+	return t.logs
+}
@@ -0,0 +1,121 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"encoding/json"
+	"io"
+	"math/big"
+	"slices"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// TraceStep is a single step of a canonical trace. It only holds the fields
+// which have to be identical across client implementations, so traces taken
+// from different clients can be compared step by step.
+type TraceStep struct {
+	Pc    uint64   `json:"pc"`
+	Op    string   `json:"op"`
+	Gas   uint64   `json:"gas"`
+	Stack []string `json:"stack"`
+}
+
+func (s *TraceStep) equal(other *TraceStep) bool {
+	return s.Pc == other.Pc && s.Op == other.Op && s.Gas == other.Gas && slices.Equal(s.Stack, other.Stack)
+}
+
+// CanonicalLogger is an EVM tracer that writes every execution step as a
+// TraceStep JSON object into the provided stream, one step per line.
+type CanonicalLogger struct {
+	encoder *json.Encoder
+}
+
+// NewCanonicalLogger creates a new EVM tracer emitting a canonical trace into
+// the provided stream.
+func NewCanonicalLogger(writer io.Writer) *CanonicalLogger {
+	return &CanonicalLogger{encoder: json.NewEncoder(writer)}
+}
+
+func (l *CanonicalLogger) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+
+func (l *CanonicalLogger) CaptureFault(pc uint64, op vm.OpCode, gas uint64, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+// CaptureState outputs the canonical step on the logger.
+func (l *CanonicalLogger) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	data := scope.Stack.Data()
+	stack := make([]string, len(data))
+
+	for i := range data {
+		stack[i] = data[i].Hex()
+	}
+
+	// nolint:errchkjson
+	_ = l.encoder.Encode(TraceStep{Pc: pc, Op: op.String(), Gas: gas, Stack: stack})
+}
+
+func (l *CanonicalLogger) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+
+func (l *CanonicalLogger) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (l *CanonicalLogger) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (l *CanonicalLogger) CaptureTxStart(gasLimit uint64) {}
+
+func (l *CanonicalLogger) CaptureTxEnd(restGas uint64) {}
+
+// TraceDiff is a step at which two canonical traces diverge. A or B is nil if
+// the respective trace ended before the step.
+type TraceDiff struct {
+	Step int
+	A    *TraceStep
+	B    *TraceStep
+}
+
+// DiffTraces compares two canonical traces step by step and returns all the
+// steps at which they differ. A stream is considered to have ended at the first
+// step which can't be decoded.
+func DiffTraces(a, b io.Reader) []TraceDiff {
+	var (
+		diffs    []TraceDiff
+		decoderA = json.NewDecoder(a)
+		decoderB = json.NewDecoder(b)
+	)
+
+	for step := 0; ; step++ {
+		stepA, stepB := new(TraceStep), new(TraceStep)
+
+		if err := decoderA.Decode(stepA); err != nil {
+			stepA = nil
+		}
+
+		if err := decoderB.Decode(stepB); err != nil {
+			stepB = nil
+		}
+
+		switch {
+		case stepA == nil && stepB == nil:
+			return diffs
+		case stepA == nil || stepB == nil || !stepA.equal(stepB):
+			diffs = append(diffs, TraceDiff{Step: step, A: stepA, B: stepB})
+		}
+	}
+}
@@ -17,15 +17,22 @@
 package logger
 
 import (
+	"bytes"
 	"encoding/json"
 	"errors"
 	"math/big"
+	"reflect"
+	"slices"
 	"testing"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/rawdb"
 	"github.com/ethereum/go-ethereum/core/state"
+	"github.com/ethereum/go-ethereum/core/types"
 	"github.com/ethereum/go-ethereum/core/vm"
 	"github.com/ethereum/go-ethereum/params"
+	"github.com/holiman/uint256"
 )
 
 type dummyContractRef struct {
@@ -118,3 +125,579 @@ func TestStructLogMarshalingOmitEmpty(t *testing.T) {
 		})
 	}
 }
+
+func TestDiffTraces(t *testing.T) {
+	t.Parallel()
+
+	trace := func(code []byte) *bytes.Buffer {
+		var (
+			out      = new(bytes.Buffer)
+			logger   = NewCanonicalLogger(out)
+			env      = vm.NewEVM(vm.BlockContext{}, vm.TxContext{}, &dummyStatedb{}, params.TestChainConfig, vm.Config{Tracer: logger})
+			contract = vm.NewContract(&dummyContractRef{}, &dummyContractRef{}, new(big.Int), 100000)
+		)
+
+		contract.Code = code
+
+		if _, err := env.Interpreter().PreRun(contract, []byte{}, false, nil); err != nil {
+			t.Fatal(err)
+		}
+
+		return out
+	}
+
+	a := trace([]byte{byte(vm.PUSH1), 0x1, byte(vm.POP), byte(vm.STOP)})
+	b := trace([]byte{byte(vm.PUSH1), 0x2, byte(vm.POP), byte(vm.STOP)})
+
+	if diffs := DiffTraces(bytes.NewReader(a.Bytes()), bytes.NewReader(a.Bytes())); len(diffs) != 0 {
+		t.Fatalf("identical traces reported %d differences", len(diffs))
+	}
+
+	// The pushed value only shows up on the stack of the POP step
+	diffs := DiffTraces(a, b)
+	if len(diffs) != 1 {
+		t.Fatalf("expected 1 difference, got %d: %v", len(diffs), diffs)
+	}
+
+	if diff := diffs[0]; diff.Step != 1 || diff.A.Op != "POP" || diff.A.Stack[0] != "0x1" || diff.B.Stack[0] != "0x2" {
+		t.Errorf("unexpected difference %+v %+v", diff.A, diff.B)
+	}
+}
+
+func testBlockContext() vm.BlockContext {
+	return vm.BlockContext{
+		CanTransfer: func(vm.StateDB, common.Address, *big.Int) bool { return true },
+		Transfer:    func(vm.StateDB, common.Address, common.Address, *big.Int) {},
+		BlockNumber: new(big.Int),
+	}
+}
+
+// newTestState returns an in-memory state with the given contracts deployed
+func newTestState(contracts map[common.Address][]byte) *state.StateDB {
+	statedb, _ := state.New(types.EmptyRootHash, state.NewDatabase(rawdb.NewMemoryDatabase()), nil)
+	for addr, code := range contracts {
+		statedb.SetCode(addr, code)
+	}
+
+	statedb.Finalise(true)
+
+	return statedb
+}
+
+func TestOpcodeProfiler(t *testing.T) {
+	const slowOp = vm.OpCode(0x0c) // unassigned opcode
+
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{
+		address: append(bytes.Repeat([]byte{byte(slowOp)}, 20), byte(vm.STOP)),
+	})
+
+	profiler := NewOpcodeProfiler()
+	evm := vm.NewEVM(testBlockContext(), vm.TxContext{}, statedb, params.AllEthashProtocolChanges, vm.Config{Tracer: profiler})
+
+	sleep := func(pc *uint64, interpreter *vm.EVMInterpreter, scope *vm.ScopeContext) ([]byte, error) {
+		time.Sleep(2 * time.Millisecond)
+		return nil, nil
+	}
+	if err := evm.Interpreter().RegisterOpcode(slowOp, sleep, 0, 0, 1024); err != nil {
+		t.Fatalf("failed to register opcode: %v", err)
+	}
+
+	if _, _, err := evm.Call(vm.AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	latencies := profiler.OpcodeLatencies()
+	if len(latencies) != 2 {
+		t.Fatalf("expected latencies of 2 opcodes, got %d", len(latencies))
+	}
+
+	slow := latencies[slowOp]
+	if slow.P50 < 2*time.Millisecond || slow.P50 > slow.P95 || slow.P95 > slow.P99 || slow.P99 > time.Second {
+		t.Errorf("unreasonable latencies for slow opcode: %+v", slow)
+	}
+
+	if stop := latencies[vm.STOP]; stop.P99 >= 2*time.Millisecond {
+		t.Errorf("unreasonable latencies for STOP: %+v", stop)
+	}
+
+	// the latency of a call includes the execution of the callee
+	caller := common.BytesToAddress([]byte("caller"))
+	callerCode := []byte{byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH20)} // retSize, retOffset, argsSize, argsOffset
+	callerCode = append(callerCode, address.Bytes()...)
+	callerCode = append(callerCode, byte(vm.GAS), byte(vm.STATICCALL), byte(vm.STOP))
+	statedb.SetCode(caller, callerCode)
+
+	if _, _, err := evm.Call(vm.AccountRef(common.Address{}), caller, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	if call := profiler.OpcodeLatencies()[vm.STATICCALL]; call.P50 < 40*time.Millisecond {
+		t.Errorf("call latency without the callee: %+v", call)
+	}
+}
+
+func TestOpcodeSequenceTracer(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{
+		// push(1) push(6) jump invalid jumpdest pop stop
+		address: {byte(vm.PUSH1), 1, byte(vm.PUSH1), 6, byte(vm.JUMP), byte(vm.INVALID), byte(vm.JUMPDEST), byte(vm.POP), byte(vm.STOP)},
+	})
+
+	tracer := NewOpcodeSequenceTracer()
+	evm := vm.NewEVM(testBlockContext(), vm.TxContext{}, statedb, params.AllEthashProtocolChanges, vm.Config{Tracer: tracer})
+
+	// the second call must not accumulate the opcodes of the first one
+	for i := 0; i < 2; i++ {
+		if _, _, err := evm.Call(vm.AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+
+		want := []vm.OpCode{vm.PUSH1, vm.PUSH1, vm.JUMP, vm.JUMPDEST, vm.POP, vm.STOP}
+		if have := tracer.OpcodeSequence(); !slices.Equal(have, want) {
+			t.Errorf("call %d: opcode sequence mismatch: have %v, want %v", i, have, want)
+		}
+	}
+}
+
+func TestOverflowTracer(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+
+	// max is pushed as 0 - 1, which wraps already
+	pushMax := []byte{byte(vm.PUSH1), 1, byte(vm.PUSH1), 0, byte(vm.SUB)}
+
+	code := []byte{byte(vm.PUSH1), 2, byte(vm.PUSH1), 1, byte(vm.ADD), byte(vm.POP)} // 1 + 2
+	code = append(code, byte(vm.PUSH1), 1)
+	code = append(code, pushMax...)
+	code = append(code, byte(vm.ADD), byte(vm.POP))                                       // max + 1
+	code = append(code, byte(vm.PUSH1), 1, byte(vm.PUSH1), 2, byte(vm.SUB), byte(vm.POP)) // 2 - 1
+	code = append(code, byte(vm.PUSH1), 2)
+	code = append(code, pushMax...)
+	code = append(code, byte(vm.MUL), byte(vm.POP))                                        // max * 2
+	code = append(code, byte(vm.PUSH1), 3, byte(vm.PUSH1), 2, byte(vm.MUL), byte(vm.STOP)) // 2 * 3
+
+	type overflow struct {
+		op vm.OpCode
+		pc uint64
+	}
+
+	var overflows []overflow
+
+	tracer := NewOverflowTracer(func(op vm.OpCode, pc uint64) { overflows = append(overflows, overflow{op, pc}) })
+	evm := vm.NewEVM(testBlockContext(), vm.TxContext{}, newTestState(map[common.Address][]byte{address: code}), params.AllEthashProtocolChanges, vm.Config{Tracer: tracer})
+
+	if _, _, err := evm.Call(vm.AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("call failed: %v", err)
+	}
+
+	want := []overflow{{vm.SUB, 12}, {vm.ADD, 13}, {vm.SUB, 27}, {vm.MUL, 28}}
+	if !slices.Equal(overflows, want) {
+		t.Errorf("overflows mismatch: have %v, want %v", overflows, want)
+	}
+}
+
+func TestSyntheticCostTracer(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{
+		// push(2) push(3) add pop stop
+		address: {byte(vm.PUSH1), 2, byte(vm.PUSH1), 3, byte(vm.ADD), byte(vm.POP), byte(vm.STOP)},
+	})
+
+	var table [256]uint64
+	table[vm.PUSH1] = 1
+	table[vm.ADD] = 10
+	table[vm.POP] = 100
+
+	tracer := NewSyntheticCostTracer(&table)
+	evm := vm.NewEVM(testBlockContext(), vm.TxContext{}, statedb, params.AllEthashProtocolChanges, vm.Config{Tracer: tracer})
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := evm.Call(vm.AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+
+		// the cost is accumulated per call, STOP is free
+		if have := tracer.SyntheticCost(); have != 112 {
+			t.Errorf("call %d: synthetic cost mismatch: have %d, want %d", i, have, 112)
+		}
+	}
+}
+
+func TestContractsTracer(t *testing.T) {
+	var (
+		outer    = common.BytesToAddress([]byte("outer"))
+		middle   = common.BytesToAddress([]byte("middle"))
+		delegate = common.BytesToAddress([]byte("delegate"))
+	)
+
+	// call returns bytecode calling target with no value, args or return data
+	call := func(op vm.OpCode, target common.Address) []byte {
+		code := []byte{byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0} // retSize, retOffset, argsSize, argsOffset
+		if op == vm.CALL {
+			code = append(code, byte(vm.PUSH1), 0) // value
+		}
+
+		code = append(code, byte(vm.PUSH20))
+		code = append(code, target.Bytes()...)
+
+		return append(code, byte(vm.GAS), byte(op), byte(vm.POP))
+	}
+
+	statedb := newTestState(map[common.Address][]byte{
+		// middle is called twice but only counted once
+		outer:    append(append(call(vm.CALL, middle), call(vm.CALL, middle)...), byte(vm.STOP)),
+		middle:   append(call(vm.DELEGATECALL, delegate), byte(vm.STOP)),
+		delegate: {byte(vm.STOP)},
+	})
+
+	tracer := NewContractsTracer()
+	evm := vm.NewEVM(testBlockContext(), vm.TxContext{}, statedb, params.AllEthashProtocolChanges, vm.Config{Tracer: tracer})
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := evm.Call(vm.AccountRef(common.Address{}), outer, nil, 1000000, new(big.Int), nil); err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+
+		if have := tracer.ContractsTouched(); have != 3 {
+			t.Errorf("call %d: have %d contracts touched, want %d", i, have, 3)
+		}
+	}
+}
+
+func TestGasSplitTracer(t *testing.T) {
+	var (
+		compute = common.BytesToAddress([]byte("compute"))
+		memory  = common.BytesToAddress([]byte("memory"))
+		caller  = common.BytesToAddress([]byte("caller"))
+	)
+
+	callCode := []byte{byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH20)} // retSize, retOffset, argsSize, argsOffset
+	callCode = append(callCode, memory.Bytes()...)
+	callCode = append(callCode, byte(vm.GAS), byte(vm.STATICCALL), byte(vm.STOP))
+
+	contracts := map[common.Address][]byte{
+		// add(1, 2) mul(3, 4)
+		compute: {byte(vm.PUSH1), 1, byte(vm.PUSH1), 2, byte(vm.ADD), byte(vm.PUSH1), 3, byte(vm.PUSH1), 4, byte(vm.MUL), byte(vm.STOP)},
+		// mstore(0x1000, 0)
+		memory: {byte(vm.PUSH1), 0, byte(vm.PUSH2), 0x10, 0x00, byte(vm.MSTORE), byte(vm.STOP)},
+		caller: callCode,
+	}
+
+	for _, overhead := range []uint64{0, 1000} {
+		// a fresh state, as the nested call warms up memory
+		statedb := newTestState(contracts)
+		tracer := NewGasSplitTracer()
+		evm := vm.NewEVM(testBlockContext(), vm.TxContext{}, statedb, params.AllEthashProtocolChanges, vm.Config{Tracer: tracer, PerCallGasOverhead: overhead})
+
+		words := uint64(0x1020 / 32)
+		expansion := words*params.MemoryGas + words*words/params.QuadCoeffDiv
+
+		for _, tt := range []struct {
+			name            string
+			addr            common.Address
+			static, dynamic uint64
+			calls           uint64
+		}{
+			{"compute", compute, 4*vm.GasFastestStep + vm.GasFastStep + vm.GasFastestStep, 0, 0},
+			{"memory", memory, 3 * vm.GasFastestStep, expansion, 0},
+			{"nested", caller, 5*vm.GasFastestStep + params.WarmStorageReadCostEIP2929 + vm.GasQuickStep + 3*vm.GasFastestStep, params.ColdAccountAccessCostEIP2929 - params.WarmStorageReadCostEIP2929 + expansion, 1},
+		} {
+			_, leftOver, err := evm.Call(vm.AccountRef(common.Address{}), tt.addr, nil, 100000, new(big.Int), nil)
+			if err != nil {
+				t.Fatalf("%s: call failed: %v", tt.name, err)
+			}
+
+			static, dynamic := tracer.GasSplit()
+			if static != tt.static || dynamic != tt.dynamic {
+				t.Errorf("%s, overhead %d: gas split mismatch: have %d/%d, want %d/%d", tt.name, overhead, static, dynamic, tt.static, tt.dynamic)
+			}
+
+			if used := 100000 - leftOver; static+dynamic+tt.calls*overhead != used {
+				t.Errorf("%s, overhead %d: gas split doesn't add up to the gas used: have %d, want %d", tt.name, overhead, static+dynamic+tt.calls*overhead, used)
+			}
+		}
+	}
+}
+
+func TestLogTracer(t *testing.T) {
+	var (
+		address = common.BytesToAddress([]byte("contract"))
+		emitter = common.BytesToAddress([]byte("emitter"))
+	)
+
+	// mstore8(0, 0xaa) log1(0, 1, 7) staticcall(gas, emitter, 0, 0, 0, 0) log0(0, 0)
+	code := []byte{
+		byte(vm.PUSH1), 0xaa, byte(vm.PUSH1), 0, byte(vm.MSTORE8),
+		byte(vm.PUSH1), 7, byte(vm.PUSH1), 1, byte(vm.PUSH1), 0, byte(vm.LOG1),
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH20),
+	}
+	code = append(code, emitter.Bytes()...)
+	code = append(code, byte(vm.GAS), byte(vm.STATICCALL), byte(vm.POP), byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.LOG0))
+
+	statedb := newTestState(map[common.Address][]byte{
+		address: code,
+		// log0(0, 0), which fails in the static call
+		emitter: {byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.LOG0)},
+	})
+
+	tracer := NewLogTracer()
+	evm := vm.NewEVM(testBlockContext(), vm.TxContext{}, statedb, params.AllEthashProtocolChanges, vm.Config{Tracer: tracer})
+
+	want := []*types.Log{
+		{Address: address, Topics: []common.Hash{common.BigToHash(big.NewInt(7))}, Data: []byte{0xaa}},
+		{Address: address, Topics: []common.Hash{}},
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, _, err := evm.Call(vm.AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); err != nil {
+			t.Fatalf("call failed: %v", err)
+		}
+
+		if have := tracer.Logs(); !reflect.DeepEqual(have, want) {
+			t.Errorf("call %d: logs mismatch: have %v, want %v", i, have, want)
+		}
+	}
+}
+
+// pausingMetricsTracer blocks the call at the first execution of an opcode until it's resumed
+type pausingMetricsTracer struct {
+	*MetricsTracer
+	at     vm.OpCode
+	paused chan struct{}
+	resume chan struct{}
+}
+
+func (t *pausingMetricsTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	t.MetricsTracer.CaptureState(pc, op, gas, cost, scope, rData, depth, err)
+
+	if op == t.at && t.paused != nil {
+		close(t.paused)
+		t.paused = nil
+		<-t.resume
+	}
+}
+
+func TestMetricsTracer(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{
+		// mstore(0x40, 1), caller, pop
+		address: {byte(vm.PUSH1), 1, byte(vm.PUSH1), 0x40, byte(vm.MSTORE), byte(vm.CALLER), byte(vm.POP), byte(vm.STOP)},
+	})
+
+	tracer := &pausingMetricsTracer{MetricsTracer: NewMetricsTracer(), at: vm.CALLER, paused: make(chan struct{}), resume: make(chan struct{})}
+	paused := tracer.paused
+
+	evm := vm.NewEVM(testBlockContext(), vm.TxContext{}, statedb, params.AllEthashProtocolChanges, vm.Config{Tracer: tracer})
+
+	done := make(chan error)
+
+	go func() {
+		_, _, err := evm.Call(vm.AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil)
+		done <- err
+	}()
+
+	// the call is paused at the CALLER, whose gas has been charged already
+	<-paused
+
+	want := RunMetrics{Opcodes: 4, StaticGas: 3 + 3 + 3 + 2, DynamicGas: 9, PeakMemory: 96}
+	if have := tracer.MetricsSnapshot(); have != want {
+		t.Errorf("snapshot mid-call: have %+v, want %+v", have, want)
+	}
+
+	close(tracer.resume)
+
+	if err := <-done; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	want = RunMetrics{Opcodes: 6, StaticGas: 3 + 3 + 3 + 2 + 2, DynamicGas: 9, PeakMemory: 96}
+	if have := tracer.MetricsSnapshot(); have != want {
+		t.Errorf("snapshot after the call: have %+v, want %+v", have, want)
+	}
+}
+
+func TestMetricsTracerCallGas(t *testing.T) {
+	var (
+		caller = common.BytesToAddress([]byte("caller"))
+		memory = common.BytesToAddress([]byte("memory"))
+	)
+
+	// call returns bytecode calling memory with value and no args or return data
+	call := func(op vm.OpCode, value byte) []byte {
+		code := []byte{byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), 0} // retSize, retOffset, argsSize, argsOffset
+		if op == vm.CALL {
+			code = append(code, byte(vm.PUSH1), value)
+		}
+
+		code = append(code, byte(vm.PUSH20))
+		code = append(code, memory.Bytes()...)
+
+		return append(code, byte(vm.GAS), byte(op), byte(vm.POP))
+	}
+
+	// a call with value the caller can't afford doesn't enter the callee, the others do
+	code := append(call(vm.CALL, 2), call(vm.CALL, 1)...)
+	code = append(code, call(vm.STATICCALL, 0)...)
+
+	for _, overhead := range []uint64{0, 1000} {
+		statedb := newTestState(map[common.Address][]byte{
+			caller: code,
+			// mstore(0x1000, 0)
+			memory: {byte(vm.PUSH1), 0, byte(vm.PUSH2), 0x10, 0x00, byte(vm.MSTORE), byte(vm.STOP)},
+		})
+		statedb.SetBalance(caller, big.NewInt(1))
+
+		blockCtx := testBlockContext()
+		blockCtx.CanTransfer = func(db vm.StateDB, addr common.Address, amount *big.Int) bool {
+			return db.GetBalance(addr).Cmp(amount) >= 0
+		}
+
+		tracer := NewMetricsTracer()
+		evm := vm.NewEVM(blockCtx, vm.TxContext{}, statedb, params.AllEthashProtocolChanges, vm.Config{Tracer: tracer, PerCallGasOverhead: overhead})
+
+		_, leftOver, err := evm.Call(vm.AccountRef(common.Address{}), caller, nil, 100000, new(big.Int), nil)
+		if err != nil {
+			t.Fatalf("overhead %d: call failed: %v", overhead, err)
+		}
+
+		// the stipends of the calls with value are given on top of the gas charged
+		have := tracer.MetricsSnapshot()
+		if charged, used := have.StaticGas+have.DynamicGas+3*overhead, 100000-leftOver+2*params.CallStipend; charged != used {
+			t.Errorf("overhead %d: gas charged doesn't add up to the gas used: have %d, want %d", overhead, charged, used)
+		}
+	}
+}
+
+func TestStepTracer(t *testing.T) {
+	var (
+		address = common.BytesToAddress([]byte("contract"))
+		callee  = common.BytesToAddress([]byte("callee"))
+	)
+
+	// 2 + 3, jumps over the INVALID, staticcall(0x100, callee, 0, 0, 0, 0)
+	code := []byte{
+		byte(vm.PUSH1), 2, byte(vm.PUSH1), 3, byte(vm.ADD), byte(vm.PUSH1), 9, byte(vm.JUMP), byte(vm.INVALID), byte(vm.JUMPDEST),
+		byte(vm.PUSH1), 0, byte(vm.DUP1), byte(vm.DUP1), byte(vm.DUP1), byte(vm.PUSH20),
+	}
+	code = append(code, callee.Bytes()...)
+	code = append(code, byte(vm.PUSH2), 0x01, 0x00, byte(vm.STATICCALL), byte(vm.STOP))
+
+	statedb := newTestState(map[common.Address][]byte{
+		address: code,
+		// return(0, 0)
+		callee: {byte(vm.PUSH1), 0, byte(vm.DUP1), byte(vm.RETURN)},
+	})
+
+	tracer := NewStepTracer()
+	evm := vm.NewEVM(testBlockContext(), vm.TxContext{}, statedb, params.AllEthashProtocolChanges, vm.Config{Tracer: tracer})
+
+	if _, _, err := evm.Call(vm.AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// the callee gets the 0x100 gas, uses 6 of them and returns the rest
+	callGas := params.ColdAccountAccessCostEIP2929 + 0x100
+	want := []StepRecord{
+		{PC: 0, Op: vm.PUSH1, Depth: 1, GasBefore: 100000, GasAfter: 99997, StackTop: uint256.NewInt(2)},
+		{PC: 2, Op: vm.PUSH1, Depth: 1, GasBefore: 99997, GasAfter: 99994, StackTop: uint256.NewInt(3)},
+		{PC: 4, Op: vm.ADD, Depth: 1, GasBefore: 99994, GasAfter: 99991, StackTop: uint256.NewInt(5)},
+		{PC: 5, Op: vm.PUSH1, Depth: 1, GasBefore: 99991, GasAfter: 99988, StackTop: uint256.NewInt(9)},
+		{PC: 7, Op: vm.JUMP, Depth: 1, GasBefore: 99988, GasAfter: 99980, StackTop: uint256.NewInt(5)},
+		{PC: 9, Op: vm.JUMPDEST, Depth: 1, GasBefore: 99980, GasAfter: 99979, StackTop: uint256.NewInt(5)},
+		{PC: 10, Op: vm.PUSH1, Depth: 1, GasBefore: 99979, GasAfter: 99976, StackTop: uint256.NewInt(0)},
+		{PC: 12, Op: vm.DUP1, Depth: 1, GasBefore: 99976, GasAfter: 99973, StackTop: uint256.NewInt(0)},
+		{PC: 13, Op: vm.DUP1, Depth: 1, GasBefore: 99973, GasAfter: 99970, StackTop: uint256.NewInt(0)},
+		{PC: 14, Op: vm.DUP1, Depth: 1, GasBefore: 99970, GasAfter: 99967, StackTop: uint256.NewInt(0)},
+		{PC: 15, Op: vm.PUSH20, Depth: 1, GasBefore: 99967, GasAfter: 99964, StackTop: new(uint256.Int).SetBytes(callee.Bytes())},
+		{PC: 36, Op: vm.PUSH2, Depth: 1, GasBefore: 99964, GasAfter: 99961, StackTop: uint256.NewInt(0x100)},
+		{PC: 39, Op: vm.STATICCALL, Depth: 1, GasBefore: 99961, GasAfter: 99961 - callGas + 0x100 - 6, StackTop: uint256.NewInt(1)},
+		{PC: 0, Op: vm.PUSH1, Depth: 2, GasBefore: 0x100, GasAfter: 0x100 - 3, StackTop: uint256.NewInt(0)},
+		{PC: 2, Op: vm.DUP1, Depth: 2, GasBefore: 0x100 - 3, GasAfter: 0x100 - 6, StackTop: uint256.NewInt(0)},
+		{PC: 3, Op: vm.RETURN, Depth: 2, GasBefore: 0x100 - 6, GasAfter: 0x100 - 6},
+		{PC: 40, Op: vm.STOP, Depth: 1, GasBefore: 99961 - callGas + 0x100 - 6, GasAfter: 99961 - callGas + 0x100 - 6, StackTop: uint256.NewInt(1)},
+	}
+
+	if have := tracer.StepRecords(); !reflect.DeepEqual(have, want) {
+		t.Errorf("step records mismatch:\nhave %+v\nwant %+v", have, want)
+	}
+}
+
+func TestExecutionHashTracer(t *testing.T) {
+	address := common.BytesToAddress([]byte("contract"))
+	statedb := newTestState(map[common.Address][]byte{
+		// mstore(0, 1 + 2), return(0, 32)
+		address: {byte(vm.PUSH1), 1, byte(vm.PUSH1), 2, byte(vm.ADD), byte(vm.PUSH1), 0, byte(vm.MSTORE), byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN)},
+	})
+
+	tracer := NewExecutionHashTracer()
+	evm := vm.NewEVM(testBlockContext(), vm.TxContext{}, statedb, params.AllEthashProtocolChanges, vm.Config{Tracer: tracer})
+
+	run := func(gas uint64) common.Hash {
+		if _, _, err := evm.Call(vm.AccountRef(common.Address{}), address, nil, gas, new(big.Int), nil); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		return tracer.ExecutionHash()
+	}
+
+	// the hash is reset per call
+	first, second := run(100000), run(100000)
+	if first != second {
+		t.Errorf("identical calls: hashes %x and %x differ", first, second)
+	}
+
+	if other := run(99999); other == first {
+		t.Errorf("calls with different gas: same hash %x", other)
+	}
+}
+
+func TestAccessCountTracer(t *testing.T) {
+	var (
+		address = common.BytesToAddress([]byte("contract"))
+		other   = common.BytesToAddress([]byte("other"))
+	)
+
+	// sload(1) twice, sstore(1, 5), balance(other) twice, extcodesize(other)
+	code := []byte{
+		byte(vm.PUSH1), 1, byte(vm.SLOAD), byte(vm.POP),
+		byte(vm.PUSH1), 1, byte(vm.SLOAD), byte(vm.POP),
+		byte(vm.PUSH1), 5, byte(vm.PUSH1), 1, byte(vm.SSTORE),
+	}
+	for _, op := range []vm.OpCode{vm.BALANCE, vm.BALANCE, vm.EXTCODESIZE} {
+		code = append(code, byte(vm.PUSH20))
+		code = append(code, other.Bytes()...)
+		code = append(code, byte(op), byte(vm.POP))
+	}
+
+	code = append(code, byte(vm.STOP))
+
+	statedb := newTestState(map[common.Address][]byte{address: code})
+	statedb.AddAddressToAccessList(address)
+
+	tracer := NewAccessCountTracer()
+	evm := vm.NewEVM(testBlockContext(), vm.TxContext{}, statedb, params.AllEthashProtocolChanges, vm.Config{Tracer: tracer})
+
+	tests := []struct {
+		name                                             string
+		coldAccounts, warmAccounts, coldSlots, warmSlots int
+	}{
+		{"first call", 1, 2, 1, 2},
+		// the access list is kept, so the second call only finds warm accesses
+		{"second call", 0, 3, 0, 3},
+	}
+
+	for _, test := range tests {
+		if _, _, err := evm.Call(vm.AccountRef(common.Address{}), address, nil, 100000, new(big.Int), nil); err != nil {
+			t.Fatalf("%s: unexpected error: %v", test.name, err)
+		}
+
+		coldAccounts, warmAccounts, coldSlots, warmSlots := tracer.AccessCounts()
+		if coldAccounts != test.coldAccounts || warmAccounts != test.warmAccounts {
+			t.Errorf("%s: accounts: have %d cold, %d warm, want %d cold, %d warm", test.name, coldAccounts, warmAccounts, test.coldAccounts, test.warmAccounts)
+		}
+
+		if coldSlots != test.coldSlots || warmSlots != test.warmSlots {
+			t.Errorf("%s: slots: have %d cold, %d warm, want %d cold, %d warm", test.name, coldSlots, warmSlots, test.coldSlots, test.warmSlots)
+		}
+	}
+}
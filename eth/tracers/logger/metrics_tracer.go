@@ -0,0 +1,146 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"math/big"
+	"sync/atomic"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/params"
+)
+
+// RunMetrics is a snapshot of the statistics of a top-level call, see MetricsTracer
+type RunMetrics struct {
+	Opcodes    uint64 // Opcodes executed so far, including those of nested calls
+	StaticGas  uint64 // Constant gas charged so far
+	DynamicGas uint64 // Dynamic gas charged so far, without the gas passed on to calls
+	PeakMemory uint64 // Size of the largest memory of a frame so far, in bytes
+}
+
+// pendingCall is a call whose gas passed on to the callee is still accounted as dynamic gas
+type pendingCall struct {
+	gasLeft uint64 // Gas of the caller once the call was charged
+	stipend uint64 // Stipend added to the gas passed on by a call with value
+}
+
+// MetricsTracer is an EVM tracer collecting the statistics of the current, or
+// else the last, top-level call. They can be read with MetricsSnapshot from
+// another goroutine while the call runs. The gas is taken from the costs passed
+// to CaptureState, so vm.Config.TraceNetCost must be disabled.
+type MetricsTracer struct {
+	table    vm.JumpTable
+	overhead uint64 // vm.Config.PerCallGasOverhead of the traced EVM
+	calls    frameSteps[pendingCall]
+
+	opcodes, staticGas, dynamicGas, peakMemory atomic.Uint64
+}
+
+// NewMetricsTracer creates a new metrics tracer.
+func NewMetricsTracer() *MetricsTracer {
+	return &MetricsTracer{}
+}
+
+func (t *MetricsTracer) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	// the forks without an instruction set of their own fall back to the latest one
+	rules := env.ChainConfig().Rules(env.Context.BlockNumber, env.Context.Random != nil, env.Context.Time)
+	t.table, _ = vm.LookupInstructionSet(rules)
+	t.overhead = env.Config.PerCallGasOverhead
+
+	t.calls.reset()
+	t.calls.enter()
+
+	t.opcodes.Store(0)
+	t.staticGas.Store(0)
+	t.dynamicGas.Store(0)
+	t.peakMemory.Store(0)
+}
+
+// CaptureState accounts op, once all of its gas was charged.
+func (t *MetricsTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	t.opcodes.Add(1)
+
+	// a call which didn't enter the callee, e.g. for lack of balance, returned all of its gas
+	if call := t.calls.swap(nil); call != nil {
+		t.dynamicGas.Add(-(gas - call.gasLeft - call.stipend))
+	}
+
+	if err != nil {
+		return
+	}
+
+	static := t.table[op].ConstantGas()
+	dynamic := cost - static
+
+	switch op {
+	case vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL:
+		var stipend uint64
+		if (op == vm.CALL || op == vm.CALLCODE) && !scope.Stack.Back(2).IsZero() {
+			stipend = params.CallStipend
+		}
+
+		t.calls.swap(&pendingCall{gasLeft: gas - cost, stipend: stipend})
+
+		dynamic -= t.overhead
+	case vm.CREATE, vm.CREATE2:
+		dynamic -= t.overhead
+	}
+
+	t.staticGas.Add(static)
+	t.dynamicGas.Add(dynamic)
+
+	if size := uint64(scope.Memory.Len()); size > t.peakMemory.Load() {
+		t.peakMemory.Store(size)
+	}
+}
+
+func (t *MetricsTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *MetricsTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	t.calls.exit()
+}
+
+// CaptureEnter takes the gas passed on to the callee out of the dynamic gas of the call.
+func (t *MetricsTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	if call := t.calls.swap(nil); call != nil {
+		t.dynamicGas.Add(-(gas - call.stipend))
+	}
+
+	t.calls.enter()
+}
+
+func (t *MetricsTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.calls.exit()
+}
+
+func (t *MetricsTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *MetricsTracer) CaptureTxEnd(restGas uint64) {}
+
+// MetricsSnapshot returns the statistics of the current top-level call so far, or
+// of the last one. It's safe to call from another goroutine, but the fields are
+// read one by one, so they may be an opcode apart.
+func (t *MetricsTracer) MetricsSnapshot() RunMetrics {
+	return RunMetrics{
+		Opcodes:    t.opcodes.Load(),
+		StaticGas:  t.staticGas.Load(),
+		DynamicGas: t.dynamicGas.Load(),
+		PeakMemory: t.peakMemory.Load(),
+	}
+}
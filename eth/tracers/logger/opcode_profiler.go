@@ -0,0 +1,147 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"math/big"
+	"math/rand"
+	"slices"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// opcodeLatencySamples is the number of latencies kept per opcode
+const opcodeLatencySamples = 1024
+
+// Percentiles holds the latency percentiles of an opcode
+type Percentiles struct {
+	P50 time.Duration
+	P95 time.Duration
+	P99 time.Duration
+}
+
+// latencyReservoir keeps a uniform sample of a bounded size over all the
+// latencies recorded for an opcode (reservoir sampling, algorithm R).
+type latencyReservoir struct {
+	samples []time.Duration
+	seen    uint64
+}
+
+// profiledStep is an opcode whose latency is being measured
+type profiledStep struct {
+	op    vm.OpCode
+	start time.Time
+}
+
+// OpcodeProfiler is an EVM tracer recording the execution latency of every
+// opcode of the last top-level call, from its step to the next step of the
+// same frame or the exit of the frame. The latency of call and create opcodes
+// thus includes the execution of the callee.
+type OpcodeProfiler struct {
+	reservoirs [256]*latencyReservoir
+	rnd        *rand.Rand
+	frames     frameSteps[profiledStep]
+}
+
+// NewOpcodeProfiler creates a new opcode latency profiler.
+func NewOpcodeProfiler() *OpcodeProfiler {
+	return &OpcodeProfiler{rnd: rand.New(rand.NewSource(1))}
+}
+
+func (p *OpcodeProfiler) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	p.reservoirs = [256]*latencyReservoir{}
+	p.frames.reset()
+	p.frames.enter()
+}
+
+// CaptureState completes the previous opcode of the frame and starts timing
+// op, unless it failed before it was executed.
+func (p *OpcodeProfiler) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	var step *profiledStep
+	if err == nil {
+		step = &profiledStep{op: op, start: time.Now()}
+	}
+
+	p.record(p.frames.swap(step))
+}
+
+func (p *OpcodeProfiler) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	p.record(p.frames.swap(nil))
+}
+
+func (p *OpcodeProfiler) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	p.record(p.frames.exit())
+}
+
+func (p *OpcodeProfiler) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	p.frames.enter()
+}
+
+func (p *OpcodeProfiler) CaptureExit(output []byte, gasUsed uint64, err error) {
+	p.record(p.frames.exit())
+}
+
+func (p *OpcodeProfiler) CaptureTxStart(gasLimit uint64) {}
+
+func (p *OpcodeProfiler) CaptureTxEnd(restGas uint64) {}
+
+// record adds the latency of a completed step to the sample of its opcode
+func (p *OpcodeProfiler) record(step *profiledStep) {
+	if step == nil {
+		return
+	}
+
+	r := p.reservoirs[step.op]
+	if r == nil {
+		r = &latencyReservoir{}
+		p.reservoirs[step.op] = r
+	}
+
+	r.seen++
+
+	d := time.Since(step.start)
+	if len(r.samples) < opcodeLatencySamples {
+		r.samples = append(r.samples, d)
+	} else if i := p.rnd.Uint64() % r.seen; i < opcodeLatencySamples {
+		r.samples[i] = d
+	}
+}
+
+// OpcodeLatencies returns the nearest-rank p50/p95/p99 latencies of every
+// opcode executed in the last top-level call.
+func (p *OpcodeProfiler) OpcodeLatencies() map[vm.OpCode]Percentiles {
+	res := make(map[vm.OpCode]Percentiles)
+
+	for op, r := range p.reservoirs {
+		if r == nil {
+			continue
+		}
+
+		sorted := slices.Clone(r.samples)
+		slices.Sort(sorted)
+
+		rank := func(p int) time.Duration {
+			return sorted[(len(sorted)*p+99)/100-1]
+		}
+
+		res[vm.OpCode(op)] = Percentiles{P50: rank(50), P95: rank(95), P99: rank(99)}
+	}
+
+	return res
+}
@@ -0,0 +1,64 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// OpcodeSequenceTracer is an EVM tracer recording the opcodes executed in the
+// last top-level call in order, including those of nested calls. The sequence
+// is a lightweight fingerprint to compare executions by.
+type OpcodeSequenceTracer struct {
+	sequence []vm.OpCode
+}
+
+// NewOpcodeSequenceTracer creates a new opcode sequence tracer.
+func NewOpcodeSequenceTracer() *OpcodeSequenceTracer {
+	return &OpcodeSequenceTracer{}
+}
+
+func (t *OpcodeSequenceTracer) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.sequence = nil
+}
+
+// CaptureState appends op to the sequence.
+func (t *OpcodeSequenceTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	t.sequence = append(t.sequence, op)
+}
+
+func (t *OpcodeSequenceTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *OpcodeSequenceTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+
+func (t *OpcodeSequenceTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *OpcodeSequenceTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *OpcodeSequenceTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *OpcodeSequenceTracer) CaptureTxEnd(restGas uint64) {}
+
+// OpcodeSequence returns the opcodes executed in the last top-level call.
+func (t *OpcodeSequenceTracer) OpcodeSequence() []vm.OpCode {
+	return t.sequence
+}
@@ -0,0 +1,77 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+// OverflowTracer is an EVM tracer reporting every ADD, SUB and MUL whose result
+// wraps around the 256-bit word. The EVM wraps by design, but an unintended wrap
+// is a common contract bug.
+type OverflowTracer struct {
+	onOverflow func(op vm.OpCode, pc uint64)
+}
+
+// NewOverflowTracer creates a new tracer calling onOverflow for every wrapping
+// arithmetic opcode.
+func NewOverflowTracer(onOverflow func(op vm.OpCode, pc uint64)) *OverflowTracer {
+	return &OverflowTracer{onOverflow: onOverflow}
+}
+
+func (t *OverflowTracer) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+}
+
+// CaptureState checks the operands of an arithmetic opcode about to be executed.
+func (t *OverflowTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if err != nil {
+		return
+	}
+
+	var overflow bool
+
+	switch op {
+	case vm.ADD:
+		_, overflow = new(uint256.Int).AddOverflow(scope.Stack.Back(0), scope.Stack.Back(1))
+	case vm.SUB:
+		_, overflow = new(uint256.Int).SubOverflow(scope.Stack.Back(0), scope.Stack.Back(1))
+	case vm.MUL:
+		_, overflow = new(uint256.Int).MulOverflow(scope.Stack.Back(0), scope.Stack.Back(1))
+	}
+
+	if overflow {
+		t.onOverflow(op, pc)
+	}
+}
+
+func (t *OverflowTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *OverflowTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+
+func (t *OverflowTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *OverflowTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *OverflowTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *OverflowTracer) CaptureTxEnd(restGas uint64) {}
@@ -0,0 +1,121 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/holiman/uint256"
+)
+
+// StepRecord is an opcode recorded by a StepTracer
+type StepRecord struct {
+	PC        uint64
+	Op        vm.OpCode
+	Depth     int
+	GasBefore uint64       // Gas of the frame before the opcode was charged
+	GasAfter  uint64       // Gas of the frame after the opcode was executed, including the gas returned by a call
+	StackTop  *uint256.Int // Copy of the top of the stack after the opcode was executed, nil if it's empty
+}
+
+// StepTracer is an EVM tracer recording the gas and stack top of every opcode
+// executed in the last top-level call in order, including those of nested
+// calls, a lightweight alternative to the StructLogger for interactive
+// sessions. Opcodes which failed before they were executed, e.g. running out
+// of gas, aren't recorded.
+type StepTracer struct {
+	steps  []StepRecord
+	frames frameSteps[int] // index of the last step of every frame, completed at its next step
+}
+
+// NewStepTracer creates a new step tracer.
+func NewStepTracer() *StepTracer {
+	return &StepTracer{}
+}
+
+func (t *StepTracer) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.steps = nil
+	t.frames.reset()
+	t.frames.enter()
+}
+
+// CaptureState completes the previous step of the frame and records op.
+func (t *StepTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	if prev := t.frames.swap(nil); prev != nil {
+		t.complete(*prev, gas, scope.Stack, 0)
+	}
+
+	if err != nil {
+		return
+	}
+
+	t.steps = append(t.steps, StepRecord{PC: pc, Op: op, Depth: depth, GasBefore: gas})
+	step := len(t.steps) - 1
+
+	// the frame ends with these, so they're completed right away, without gas used
+	// by the execution and with their arguments popped off the stack
+	switch op {
+	case vm.STOP:
+		t.complete(step, gas-cost, scope.Stack, 0)
+	case vm.SELFDESTRUCT:
+		t.complete(step, gas-cost, scope.Stack, 1)
+	case vm.RETURN, vm.REVERT:
+		t.complete(step, gas-cost, scope.Stack, 2)
+	default:
+		t.frames.swap(&step)
+	}
+}
+
+// CaptureFault completes the step failing to execute.
+func (t *StepTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+	if prev := t.frames.swap(nil); prev != nil {
+		t.complete(*prev, gas-cost, scope.Stack, 0)
+	}
+}
+
+func (t *StepTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {
+	t.frames.exit()
+}
+
+func (t *StepTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+	t.frames.enter()
+}
+
+func (t *StepTracer) CaptureExit(output []byte, gasUsed uint64, err error) {
+	t.frames.exit()
+}
+
+func (t *StepTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *StepTracer) CaptureTxEnd(restGas uint64) {}
+
+// complete sets the gas and the stack top after a step, the latter below the
+// popped items of the stack
+func (t *StepTracer) complete(step int, gasAfter uint64, stack *vm.Stack, popped int) {
+	t.steps[step].GasAfter = gasAfter
+
+	if len(stack.Data()) > popped {
+		t.steps[step].StackTop = new(uint256.Int).Set(stack.Back(popped))
+	}
+}
+
+// StepRecords returns the opcodes executed in the last top-level call.
+func (t *StepTracer) StepRecords() []StepRecord {
+	return t.steps
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package logger
+
+import (
+	"math/big"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/vm"
+)
+
+// SyntheticCostTracer is an EVM tracer summing up a benchmarking cost unit,
+// unrelated to gas, of every opcode executed in the last top-level call,
+// including those of nested calls.
+type SyntheticCostTracer struct {
+	table *[256]uint64
+	cost  uint64
+}
+
+// NewSyntheticCostTracer creates a new tracer assigning table[op] units to
+// every executed opcode.
+func NewSyntheticCostTracer(table *[256]uint64) *SyntheticCostTracer {
+	return &SyntheticCostTracer{table: table}
+}
+
+func (t *SyntheticCostTracer) CaptureStart(env *vm.EVM, from, to common.Address, create bool, input []byte, gas uint64, value *big.Int) {
+	t.cost = 0
+}
+
+// CaptureState adds the units of op to the sum.
+func (t *SyntheticCostTracer) CaptureState(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, rData []byte, depth int, err error) {
+	t.cost += t.table[op]
+}
+
+func (t *SyntheticCostTracer) CaptureFault(pc uint64, op vm.OpCode, gas, cost uint64, scope *vm.ScopeContext, depth int, err error) {
+}
+
+func (t *SyntheticCostTracer) CaptureEnd(output []byte, gasUsed uint64, err error) {}
+
+func (t *SyntheticCostTracer) CaptureEnter(typ vm.OpCode, from common.Address, to common.Address, input []byte, gas uint64, value *big.Int) {
+}
+
+func (t *SyntheticCostTracer) CaptureExit(output []byte, gasUsed uint64, err error) {}
+
+func (t *SyntheticCostTracer) CaptureTxStart(gasLimit uint64) {}
+
+func (t *SyntheticCostTracer) CaptureTxEnd(restGas uint64) {}
+
+// SyntheticCost returns the sum of the units of the opcodes executed in the
+// last top-level call.
+func (t *SyntheticCostTracer) SyntheticCost() uint64 {
+	return t.cost
+}